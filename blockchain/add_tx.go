@@ -1,38 +1,89 @@
 package blockchain
 
 import (
-	"github.com/toqueteos/altcoin/server"
+	"github.com/toqueteos/altcoin/config"
 	"github.com/toqueteos/altcoin/tools"
 	"github.com/toqueteos/altcoin/types"
 )
 
 // Attempt to add a new transaction into the pool.
-func AddTx(tx *types.Tx, db *types.DB) {
-	obj := &addTx{tx, db}
+// A tx with the same sender and Count as a pending one replaces it, if it pays
+// enough more (see mempool.Pool.Replace).
+// The returned error says why tx was rejected.
+func AddTx(tx *types.Tx, db *types.DB) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return addTxLocked(tx, db)
+}
+
+func addTxLocked(tx *types.Tx, db *types.DB) error {
 	addr := tools.MakeAddress(tx.PubKeys, len(tx.Signatures))
+	obj := &addTx{tx, db, db.Pool.Pending(addr, tx.Count) != nil}
 
-	if obj.verifyTx(addr) {
-		db.Txs = append(db.Txs, tx)
+	if err := obj.verifyTx(addr); err != nil {
+		return err
 	}
+
+	if !obj.replacing {
+		return db.Pool.Add(tx)
+	}
+
+	later, err := db.Pool.Replace(tx)
+	if err != nil {
+		return err
+	}
+	// Whatever the replacement broke stays out.
+	for _, t := range later {
+		addTxLocked(t, db)
+	}
+	return nil
 }
 
 type addTx struct {
-	tx *types.Tx
-	db *types.DB
+	tx        *types.Tx
+	db        *types.DB
+	replacing bool
+}
+
+func (obj *addTx) verifyCount(addr string) error {
+	count, err := countLocked(addr, obj.db)
+	if err != nil {
+		return err
+	}
+	if obj.tx.Count != count {
+		return ErrTxCount
+	}
+	return nil
 }
 
-func (obj *addTx) verifyCount(addr string) bool {
-	return obj.tx.Count != Count(addr, obj.db)
+// pendingTxs are the txs tx is verified against. A replacement is verified as
+// if the one it replaces and the later ones of the sender weren't there.
+func (obj *addTx) pendingTxs(addr string) []*types.Tx {
+	txs := obj.db.Pool.Txs()
+	if !obj.replacing {
+		return txs
+	}
+
+	var out []*types.Tx
+	for _, t := range txs {
+		if t.Count >= obj.tx.Count && tools.MakeAddress(t.PubKeys, len(t.Signatures)) == addr {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
 }
 
 // def type_check(tx, txs):
-// 	if 'type' not in tx:
-// 		return True
-// 	if tx['type'] == 'mint':
-// 		return True
-// 	return tx['type'] not in transactions.tx_check
+//
+//	if 'type' not in tx:
+//		return True
+//	if tx['type'] == 'mint':
+//		return True
+//	return tx['type'] not in transactions.tx_check
 func (obj *addTx) typeCheck(txs []*types.Tx) bool {
-	if obj.tx.Type == "" || obj.tx.Type == "mint" {
+	if obj.tx.Type == "" || obj.tx.Type == "mint" || obj.tx.Type == "premine" {
 		return true
 	}
 
@@ -41,37 +92,39 @@ func (obj *addTx) typeCheck(txs []*types.Tx) bool {
 	return tools.NotIn(obj.tx.Type, transactionKeys)
 }
 
-func (obj *addTx) tooBigBlock(txs []*types.Tx) bool {
-	txs = append(txs, obj.tx)
-
+// tooBigBlock tells whether tx alone is too big for a block, the pool itself
+// can hold more than a block and the miner picks what fits.
+func (obj *addTx) tooBigBlock() bool {
 	// If errors on JSONLen it returns -1
-	length := tools.JSONLen(txs)
+	length := tools.JSONLen([]*types.Tx{obj.tx})
 	if length == -1 {
 		return true
 	}
 
-	// TODO: Figure out WHY 5000
-	return length > server.MaxMessageSize-5000
+	return length > config.MaxBlockSize
 }
 
-func (obj *addTx) verifyTx(addr string) bool {
-	txs := obj.db.Txs
+func (obj *addTx) verifyTx(addr string) error {
+	txs := obj.pendingTxs(addr)
 
 	if obj.typeCheck(txs) {
-		return false
+		return ErrTxType
 	}
 
 	//if tx in txs: return False
-	for _, t := range txs {
-		if obj.tx == t {
-			return true
-		}
+	if obj.db.Pool.Get(tools.DetHash(obj.tx)) != nil {
+		return ErrTxDuplicate
 	}
 
 	// if verify_count(tx, txs): return false
 	// if too_big_block(tx, txs): return false
-	if obj.verifyCount(addr) || obj.tooBigBlock(txs) {
-		return false
+	if !obj.replacing {
+		if err := obj.verifyCount(addr); err != nil {
+			return err
+		}
+	}
+	if obj.tooBigBlock() {
+		return ErrTxTooBig
 	}
 
 	fn := transactionVerify[obj.tx.Type]
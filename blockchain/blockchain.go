@@ -4,324 +4,311 @@ package blockchain
 
 import (
 	"log"
-	"math"
-	"reflect"
 	"sort"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/difficulty"
 	"github.com/toqueteos/altcoin/tools"
 	"github.com/toqueteos/altcoin/transaction"
 	"github.com/toqueteos/altcoin/types"
 )
 
 var (
-	transactionKeys = []string{"mint", "spend"}
+	transactionKeys = []string{"mint", "spend", "premine"}
 
-	transactionUpdate = map[string]func(*types.Tx, *types.DB){
-		"mint":  transaction.Mint,
-		"spend": transaction.Spend,
+	transactionUpdate = map[string]func(*types.Tx, *types.DB) error{
+		"mint":    transaction.Mint,
+		"spend":   transaction.Spend,
+		"premine": transaction.Premine,
 	}
 
-	transactionVerify = map[string]func(*types.Tx, []*types.Tx, *types.DB) bool{
-		"mint":  transaction.MintVerify,
-		"spend": transaction.SpendVerify,
+	transactionVerify = map[string]func(*types.Tx, []*types.Tx, *types.DB) error{
+		"mint":    transaction.MintVerify,
+		"spend":   transaction.SpendVerify,
+		"premine": transaction.PremineVerify,
 	}
 
-	targets = map[int]string{}
-	times   = map[int]float64{}
-)
-
-// RecentBlockTargets grabs info from old blocks.
-// recent_blockthings(key, DB, size, length=0)
-func RecentBlockTargets(db *types.DB, size, length int) []string {
-	if length == 0 {
-		length = db.Length
+	transactionHistory = map[string]func(*types.Tx) []*types.HistoryEntry{
+		"mint":    transaction.MintHistory,
+		"spend":   transaction.SpendHistory,
+		"premine": transaction.PremineHistory,
 	}
+)
 
-	start := length - size
-	if start < 0 {
-		start = 0
-	}
+// Returns the target difficulty at a paticular blocklength, as decided by the
+// algorithm config.Get().Difficulty names.
+// target(DB, length=0)
+func Target(db *types.DB, length int) *types.Target {
+	db.RLock()
+	defer db.RUnlock()
 
-	var ts []string
-	for index := start; index < length; index++ {
-		// if not index in storage:
-		//     storage[index] = db_get(index, db)["target"]
-		_, ok := targets[index]
-		if !ok {
-			targets[index] = db.GetBlock(index).Target
-		}
+	return targetLocked(db, length)
+}
 
-		ts = append(ts, targets[index])
+func targetLocked(db *types.DB, length int) *types.Target {
+	// Blocks we already have say what their target was, they were checked to
+	// have a valid one.
+	if length <= db.Length {
+		t, _ := db.GetHeader(length).Target()
+		return t
 	}
 
-	return ts
+	alg, err := difficulty.New(config.Get())
+	if err != nil {
+		// Nodes check the config when starting, see difficulty.New.
+		panic(err)
+	}
+	return alg.Target(db, length)
 }
 
-func RecentBlockTimes(db *types.DB, size, length int) []float64 {
-	if length == 0 {
-		length = db.Length
+// CheckHeader checks header is a valid successor of the current tip for a
+// block at the given length, without looking at its txs.
+// The caller must hold db's lock.
+func CheckHeader(header *types.BlockHeader, length int, db *types.DB) error {
+	//if "target" not in block.keys(): return False
+	if err := checkDiffLength(header, db.DiffLength); err != nil {
+		return err
 	}
 
-	start := length - size
-	if start < 0 {
-		start = 0
+	if db.Length >= 0 && tools.DetHash(db.GetBlock(db.Length)) != header.PrevHash {
+		return ErrBadPrevHash
 	}
 
-	var ts []float64
-	for index := start; index < length; index++ {
-		// if not index in storage:
-		//     storage[index] = db_get(index, db)["target"]
-		_, ok := times[index]
-		if !ok {
-			t := db.GetBlock(index).Time
-			times[index] = unix(t)
-		}
+	if !CheckPoW(header) {
+		return ErrBadPoW
+	}
 
-		ts = append(ts, times[index])
+	if header.Bits != targetLocked(db, length).Compact() {
+		return ErrTargetMismatch
+	}
+
+	// if block.Time > time.time(): return false
+	// if block.Time < earliest: return false
+	if header.Time.After(db.Clock.Now().Add(config.Get().MaxFutureDrift)) {
+		return ErrTimeTooNew
+	}
+	if !header.Time.After(MedianTimePast(db, length)) {
+		return ErrTimeTooOld
 	}
 
-	return ts
+	return nil
 }
 
-// Returns the target difficulty at a paticular blocklength.
-// target(DB, length=0)
-func Target(db *types.DB, length int) string {
-	if length == 0 {
-		length = db.Length
+// checkDiffLength checks header has a valid target and the work of its chain
+// is the work of its parent's chain, parentWork, plus its own.
+func checkDiffLength(header *types.BlockHeader, parentWork *types.Work) error {
+	target, err := header.Target()
+	if err != nil || target.Int().Sign() == 0 {
+		return ErrBadTarget
 	}
-
-	// Use same difficulty for first few blocks.
-	if length < 4 {
-		return strings.Repeat("0", 4) + strings.Repeat("f", 60)
+	if header.DiffLength.Cmp(parentWork.Add(target.Work())) != 0 {
+		return ErrBadDiffLength
 	}
+	return nil
+}
 
-	if length <= db.Length {
-		return targets[length] // Memoized
+// MedianTimePast is the median time of the config.Get().MedianTimeSpan blocks
+// before the one at length, blocks must be newer than it. Unlike the time of
+// the last block it can only move forward.
+// The caller must hold db's lock.
+func MedianTimePast(db *types.DB, length int) time.Time {
+	start := length - config.Get().MedianTimeSpan
+	if start < 0 {
+		start = 0
 	}
-
-	weights := func(length int) []float64 {
-		var r []float64
-		for i := 0; i < length; i++ {
-			exp := float64(length - i)
-			r = append(r, math.Pow(config.Get().Inflection, exp))
-		}
-		return r
+	if start >= length {
+		return time.Time{}
 	}
 
-	// We are actually interested in the average number of hashes required to mine a block.
-	// Number of hashes required is inversely proportional to target.
-	// So we average over inverse-targets, and inverse the final answer.
-	estimateTarget := func(db *types.DB) string {
-		sumTargets := func(ls []string) string {
-			if len(ls) < 1 {
-				return "0" // must be string, int on python version
-			}
-
-			// This is basically an ofuscated REDUCE
-			// while len(ls) > 1:
-			// 	ls = [hexSum(ls[0], ls[1])] + ls[2:]
-			// return ls[0]
-			var r = HexSum(ls[0], ls[1])
-			for _, elem := range ls[2:] {
-				r = HexSum(r, elem)
-			}
-			return r
-		}
-
-		blocks := RecentBlockTargets(db, config.Get().HistoryLength, 0)
-		w := weights(len(blocks))
-		//tw = sum(w)
-		var tw float64
-		for _, welem := range w {
-			tw += welem
-		}
+	times := make([]time.Time, 0, length-start)
+	for i := start; i < length; i++ {
+		times = append(times, db.GetHeader(i).Time)
+	}
+	sort.Sort(byTime(times))
+	return times[len(times)/2]
+}
 
-		var targets []string
-		for _, t := range blocks {
-			targets = append(targets, HexInv(t))
-		}
+// CheckPoW reports whether header's nonce satisfies its own target.
+func CheckPoW(header *types.BlockHeader) bool {
+	target, err := header.Target()
+	if err != nil {
+		return false
+	}
 
-		weightedMultiply := func(i int) string {
-			return HexMul(targets[i], strconv.Itoa(int(w[i]/tw)))
-		}
+	// a = copy.deepcopy(block)
+	// a.pop("nonce")
+	halfWay := &types.HalfWay{
+		Nonce:    header.Nonce,
+		HalfHash: tools.DetHash(header.WithoutNonce()),
+	}
 
-		var weightedTargets []string
-		for i := 0; i < len(targets); i++ {
-			weightedTargets = append(weightedTargets, weightedMultiply(i))
-		}
+	return target.CheckHash(tools.DetHash(halfWay))
+}
 
-		return HexInv(sumTargets(weightedTargets))
+// checkTxs verifies every tx against the ones before it in the same block,
+// the block at length.
+func checkTxs(txs []*types.Tx, length int, db *types.DB) error {
+	if length := tools.JSONLen(txs); length == -1 || length > config.MaxBlockSize {
+		return ErrBlockTooBig
 	}
 
-	estimateTime := func(db *types.DB) float64 {
-		times := RecentBlockTimes(db, config.Get().HistoryLength, 0)
-
-		var lengths []float64
-		for i := 1; i < len(times); i++ {
-			lengths = append(lengths, times[i]-times[i-1])
+	for i, tx := range txs {
+		fn, ok := transactionVerify[tx.Type]
+		if !ok {
+			return &ErrTxInvalid{Index: i, Reason: ErrTxType}
 		}
-
-		// Geometric weighting
-		w := weights(len(lengths))
-
-		// Normalization constant
-		// tw = sum(w)
-		var tw float64
-		for _, elem := range w {
-			tw += elem
+		// transactions.tx_check[tx['type']](tx, out, DB)
+		if err := fn(tx, txs[:i], db); err != nil {
+			return &ErrTxInvalid{Index: i, Reason: err}
 		}
-
-		var r []float64
-		for i := 0; i < len(lengths); i++ {
-			r = append(r, w[i]*lengths[i]/tw)
+		if tx.Type == "spend" {
+			if err := checkCount(tx, txs[:i], db); err != nil {
+				return &ErrTxInvalid{Index: i, Reason: err}
+			}
 		}
 
-		// sum(r)
-		var sum float64
-		for _, elem := range r {
-			sum += elem
+		// Fees go to the miner through the mint, wherever it is in the block.
+		if tx.Type == "mint" {
+			if amount, err := transaction.MintAmount(length, txs); err != nil || tx.Amount != amount {
+				return &ErrTxInvalid{Index: i, Reason: transaction.ErrBadMintAmount}
+			}
 		}
-
-		return sum
 	}
-
-	blockTime := config.BlockTime(length)
-	retarget := estimateTime(db) / float64(blockTime)
-	return HexMul(estimateTarget(db), strconv.Itoa(int(retarget)))
+	return nil
 }
 
 // Attempts adding a new block to the blockchain.
-func AddBlock(block *types.Block, db *types.DB) {
-	txCheck := func(txs []*types.Tx) bool {
-		// start = copy.deepcopy(txs)
-		var start = txs
-		var txsSource []*types.Tx
-		var startCopy []*types.Tx
-
-		for !reflect.DeepEqual(start, startCopy) {
-			// Block passes this test
-			if start == nil {
-				return false
-			}
+// The returned error says exactly which check the block failed.
+func AddBlock(block *types.Block, db *types.DB) error {
+	db.Lock()
+	defer db.Unlock()
 
-			// startCopy = copy.deepcopy(start)
-			startCopy = start
-			last := start[len(start)-1]
-
-			// transactions.tx_check[start[-1]['type']](start[-1], out, DB)
-			fn := transactionVerify[last.Type]
-			if fn(last, txsSource, db) {
-				// start.pop()
-				start = start[:len(start)-1]
-				txsSource = append(txsSource, last)
-			} else {
-				// Block is invalid
-				return true
-			}
-		}
-
-		// Block is invalid
-		return true
-	}
+	return addBlockLocked(block, db)
+}
 
+func addBlockLocked(block *types.Block, db *types.DB) error {
 	// if "error" in block: return False
 	if block.Error != nil {
-		return
+		return ErrBlockError
 	}
 
-	// if "length" not in block: return False
-	// NOTE: block.Length not being set means it takes its "zero value".
-	// This shouldn't be a problem, check out next if stmt.
-	if block.Length == 0 {
-		return
+	// Also covers the "length" not in block check, genesis is the only block
+	// with a zero Length and it must go on top of an empty chain.
+	if block.Length != db.Length+1 {
+		return ErrBadLength
+	}
+	if block.Length == 0 && !isGenesis(tools.DetHash(block)) {
+		return ErrBadGenesis
 	}
 
-	length := db.Length
-	if block.Length != length+1 {
-		return
+	if err := CheckHeader(&block.BlockHeader, block.Length, db); err != nil {
+		return err
 	}
 
-	if block.DiffLength != HexSum(db.DiffLength, HexInv(block.Target)) {
-		return
+	// Txs must be exactly the ones committed to by the header.
+	if block.MerkleRoot != types.MerkleRoot(block.Txs) {
+		return ErrBadMerkleRoot
 	}
 
-	if length >= 0 && tools.DetHash(db.GetBlock(length)) != block.PrevHash {
-		return
+	if err := checkTxs(block.Txs, block.Length, db); err != nil {
+		return err
 	}
 
-	// a = copy.deepcopy(block)
-	// a.pop("nonce")
-	blockCopy := block
-	blockCopy.Nonce = nil
+	// block_check was unnecessary because it was only called once
+	// and it only returned true at its end
 
-	//if "target" not in block.keys(): return False
-	if block.Target == "" {
-		return
-	}
+	// if block_check(block, db):
+	log.Println("add_block:", block)
+	hash := tools.DetHash(block)
 
-	halfWay := &types.HalfWay{
-		Nonce:    block.Nonce,
-		HalfHash: tools.DetHash(blockCopy),
+	// Block, accounts, undo record and tip all go to disk together or not at
+	// all, a crash can't leave accounts out of sync with db.Length.
+	db.Begin()
+	if err := db.PutBlock(block); err != nil {
+		db.Discard()
+		return err
 	}
 
-	if tools.DetHash(halfWay) > block.Target {
-		return
+	// Remember every account we touch so DeleteBlock can put them back.
+	db.StartUndo()
+	for i, tx := range block.Txs {
+		fn := transactionUpdate[tx.Type]
+		if err := fn(tx, db); err != nil {
+			db.FinishUndo()
+			db.Discard()
+			return &ErrTxInvalid{Index: i, Reason: err}
+		}
 	}
-
-	if block.Target != Target(db, block.Length) {
-		return
+	if err := db.PutUndo(block.Length, db.FinishUndo()); err != nil {
+		db.Discard()
+		return err
 	}
-
-	// TODO: Figure out why 8 (length)?
-	earliestMedian := median(RecentBlockTimes(db, config.Get().Mmm, 8))
-	// `float64` (unix epoch) back to `time.Time`
-	sec, nsec := math.Modf(earliestMedian)
-	earliest := time.Unix(int64(sec), int64(nsec*1e9))
-
-	// if block.Time > time.time(): return false
-	// if block.Time < earliest: return false
-	if block.Time.After(time.Now()) || block.Time.Before(earliest) {
-		return
+	if db.AddressIndex {
+		if err := history(block, db.PutHistory); err != nil {
+			db.Discard()
+			return err
+		}
 	}
-
-	if txCheck(block.Txs) {
-		return
+	if err := db.PutTip(&types.Tip{Length: block.Length, Hash: hash, DiffLength: block.DiffLength}); err != nil {
+		db.Discard()
+		return err
 	}
 
-	// block_check was unnecessary because it was only called once
-	// and it only returned true at its end
-
-	// if block_check(block, db):
-	log.Println("add_block:", block)
-	db.Put(strconv.Itoa(block.Length), block)
+	if err := db.Commit(); err != nil {
+		return err
+	}
 
 	db.Length = block.Length
 	db.DiffLength = block.DiffLength
 
-	orphans := db.Txs
-	db.Txs = nil
+	// Main chain blocks are read from disk, db.Index only keeps side branches
+	// we could still reorg to: the ones forking at most MaxReorgDepth blocks
+	// below our tip.
+	db.Index.Remove(hash)
+	db.Index.Prune(db.Length - config.Get().MaxReorgDepth + 1)
 
-	for _, tx := range block.Txs {
-		db.AddBlock = true
-		fn := transactionUpdate[tx.Type]
-		fn(tx, db)
+	// Pool txs are verified again against the new state, the ones mined or
+	// no longer valid are dropped. Genesis may come before there's a pool.
+	if db.Pool == nil {
+		return nil
 	}
-
+	orphans := db.Pool.Reset()
 	for _, tx := range orphans {
-		AddTx(tx, db)
+		addTxLocked(tx, db)
 	}
+
+	return nil
 }
 
 // DeleteBlock removes the most recent block from the blockchain.
-func DeleteBlock(db *types.DB) {
+// Accounts are restored from the undo record stored by AddBlock.
+// The block goes to db.Index in case its branch becomes the best one again.
+func DeleteBlock(db *types.DB) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return deleteBlockLocked(db)
+}
+
+func deleteBlockLocked(db *types.DB) error {
 	if db.Length < 0 {
-		return
+		return nil
 	}
 
+	undo := db.GetUndo(db.Length)
+	if undo == nil {
+		return ErrNoUndo
+	}
+
+	block := db.GetBlock(db.Length)
+
+	// Same as AddBlock, everything is written in a single batch.
+	db.Begin()
+	if err := db.RestoreUndo(undo); err != nil {
+		db.Discard()
+		return err
+	}
 	// try:
 	// 	targets.pop(str(DB['length']))
 	// except:
@@ -330,33 +317,73 @@ func DeleteBlock(db *types.DB) {
 	// 	times.pop(str(DB['length']))
 	// except:
 	// 	pass
-	delete(targets, db.Length)
-	delete(times, db.Length)
+	// Also forgets its cached header.
+	if err := db.DeleteBlock(db.Length); err != nil {
+		db.Discard()
+		return err
+	}
+	if err := db.DeleteUndo(db.Length); err != nil {
+		db.Discard()
+		return err
+	}
+	if db.AddressIndex {
+		if err := history(block, db.DeleteHistory); err != nil {
+			db.Discard()
+			return err
+		}
+	}
 
-	block := db.GetBlock(db.Length)
-	orphans := sortedOrphans(db.Txs)
-	db.Txs = nil
+	var tip *types.Tip
+	diffLength := types.NewWork(0)
+	if db.Length > 0 {
+		parent := db.GetBlock(db.Length - 1)
+		tip = &types.Tip{Length: parent.Length, Hash: tools.DetHash(parent), DiffLength: parent.DiffLength}
+		diffLength = parent.DiffLength
+	}
+	if err := db.PutTip(tip); err != nil {
+		db.Discard()
+		return err
+	}
 
-	for _, tx := range block.Txs {
-		orphans = append(orphans, tx)
-		db.AddBlock = false
-		fn := transactionUpdate[tx.Type]
-		fn(tx, db)
+	if err := db.Commit(); err != nil {
+		return err
 	}
 
-	db.Delete(strconv.Itoa(db.Length))
 	db.Length--
+	db.DiffLength = diffLength
+	// It's a side block now, the blocks disconnected before it build on it
+	// and go too if there's no room.
+	if hash := tools.DetHash(block); indexBlock(hash, block, db) != nil {
+		db.Index.RemoveTree(hash)
+	}
 
-	if db.Length == -1 {
-		db.DiffLength = "0"
-	} else {
-		block = db.GetBlock(db.Length)
-		db.DiffLength = block.DiffLength
+	// Like in AddBlock there may be no pool at all.
+	if db.Pool == nil {
+		return nil
 	}
+	orphans := sortedOrphans(db.Pool.Reset())
+	orphans = append(orphans, block.Txs...)
 
 	// for orphan in sorted(orphans, key=lambda x: x["count"]):
 	sort.Sort(orphans)
 	for _, orphan := range orphans {
-		AddTx(orphan, db)
+		addTxLocked(orphan, db)
+	}
+
+	return nil
+}
+
+// history calls fn with every address history entry of block's txs.
+func history(block *types.Block, fn func(*types.HistoryEntry) error) error {
+	for i, tx := range block.Txs {
+		for _, e := range transactionHistory[tx.Type](tx) {
+			e.TxHash = tools.DetHash(tx)
+			e.Height = block.Length
+			e.Index = i
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
 }
@@ -0,0 +1,727 @@
+package blockchain
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/toqueteos/altcoin/clock"
+	"github.com/toqueteos/altcoin/coin"
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/difficulty"
+	"github.com/toqueteos/altcoin/mempool"
+	"github.com/toqueteos/altcoin/tools"
+	"github.com/toqueteos/altcoin/transaction"
+	"github.com/toqueteos/altcoin/types"
+
+	"github.com/conformal/btcec"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// someone is where test spends send their coins.
+var someone string
+
+func init() {
+	// Most tests spend rewards right away, TestMaturity has its own config.
+	params := *config.MainNet
+	params.CoinbaseMaturity = 0
+	config.Set(config.New(&params))
+
+	_, pub := tools.ParseKeyPair(tools.DetHashInt(99))
+	someone = tools.MakeAddress([]*btcec.PublicKey{pub}, 1)
+}
+
+// newTestDB returns an in-memory chain holding just the genesis block.
+func newTestDB() *types.DB {
+	ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+	if err != nil {
+		panic(err)
+	}
+	db := types.NewDB(ldb)
+	db.Pool = mempool.New(config.Get().MempoolSize, 0)
+	if err := InitChain(db); err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// account is db.GetAccount for accounts that must be readable.
+func account(db *types.DB, addr string) *types.Account {
+	acc, err := db.GetAccount(addr)
+	if err != nil {
+		panic(err)
+	}
+	return acc
+}
+
+func testMint(seed byte) *types.Tx {
+	_, pub := tools.ParseKeyPair(tools.DetHashInt(int(seed)))
+	return &types.Tx{
+		Type:       "mint",
+		Amount:     config.Get().BlockReward,
+		PubKeys:    []*btcec.PublicKey{pub},
+		Signatures: []*btcec.Signature{nil},
+	}
+}
+
+func testSpend(seed byte, count int, amount, fee coin.Amount, to string) *types.Tx {
+	priv, pub := tools.ParseKeyPair(tools.DetHashInt(int(seed)))
+	tx := &types.Tx{
+		Type:       "spend",
+		Amount:     amount,
+		Fee:        fee,
+		Count:      count,
+		PubKeys:    []*btcec.PublicKey{pub},
+		Signatures: []*btcec.Signature{nil},
+		To:         to,
+	}
+	if err := transaction.Sign(tx, priv); err != nil {
+		panic(err)
+	}
+	return tx
+}
+
+// nextBlock builds and mines a valid block on top of parent.
+func nextBlock(db *types.DB, parent *types.Block, txs ...*types.Tx) *types.Block {
+	length := parent.Length + 1
+	for _, tx := range txs {
+		if tx.Type == "mint" {
+			tx.Height = length
+		}
+	}
+	target := Target(db, length)
+	block := &types.Block{
+		BlockHeader: types.BlockHeader{
+			PrevHash:   tools.DetHash(parent),
+			MerkleRoot: types.MerkleRoot(txs),
+			Time:       parent.Time.Add(time.Second),
+			Bits:       target.Compact(),
+			DiffLength: parent.DiffLength.Add(target.Work()),
+			Nonce:      new(big.Int),
+		},
+		Length: length,
+		Txs:    txs,
+	}
+	mine(&block.BlockHeader)
+	return block
+}
+
+func mine(header *types.BlockHeader) {
+	for !CheckPoW(header) {
+		header.Nonce.Add(header.Nonce, big.NewInt(1))
+	}
+}
+
+func TestAddBlockErrors(t *testing.T) {
+	Convey("Valid blocks are accepted", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		So(db.Length, ShouldEqual, 1)
+
+		So(AddBlock(nextBlock(db, first, testMint(1)), db), ShouldBeNil)
+		So(db.Length, ShouldEqual, 2)
+	})
+
+	Convey("Each failed check has its own error", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+
+		block := nextBlock(db, first, testMint(1))
+		block.Length = 5
+		So(AddBlock(block, db), ShouldEqual, ErrBadLength)
+
+		block = nextBlock(db, first, testMint(1))
+		block.PrevHash = "00"
+		mine(&block.BlockHeader)
+		So(AddBlock(block, db), ShouldEqual, ErrBadPrevHash)
+
+		block = nextBlock(db, first, testMint(1))
+		block.Bits = 0x04800001 // Negative.
+		So(AddBlock(block, db), ShouldEqual, ErrBadTarget)
+
+		block = nextBlock(db, first, testMint(1))
+		block.Time = first.Time.Add(-time.Hour)
+		mine(&block.BlockHeader)
+		So(AddBlock(block, db), ShouldEqual, ErrTimeTooOld)
+
+		block = nextBlock(db, first, testMint(1))
+		block.Time = time.Now().Add(config.Get().MaxFutureDrift + time.Minute)
+		mine(&block.BlockHeader)
+		So(AddBlock(block, db), ShouldEqual, ErrTimeTooNew)
+
+		block = nextBlock(db, first, testMint(1))
+		block.Txs = append(block.Txs, testMint(2))
+		So(AddBlock(block, db), ShouldEqual, ErrBadMerkleRoot)
+
+		block = nextBlock(db, first, testMint(1), testMint(2))
+		err := AddBlock(block, db)
+		So(err, ShouldHaveSameTypeAs, &ErrTxInvalid{})
+		So(err.(*ErrTxInvalid).Index, ShouldEqual, 1)
+
+		So(db.Length, ShouldEqual, 1)
+	})
+}
+
+func TestAddTxErrors(t *testing.T) {
+	Convey("Mints never go into the pool", t, func() {
+		db := newTestDB()
+		So(AddTx(testMint(1), db), ShouldEqual, ErrTxType)
+	})
+
+	Convey("Spends only go to addresses of our network", t, func() {
+		db := newTestDB()
+		So(AddBlock(nextBlock(db, db.GetBlock(0), testMint(1)), db), ShouldBeNil)
+		So(AddTx(testSpend(1, 1, 50000, 2000, "someone"), db), ShouldEqual, transaction.ErrBadAddress)
+
+		mainnet := config.Get()
+		config.Set(config.New(config.TestNet))
+		testnet := "t" + someone
+		So(tools.ValidAddress(testnet), ShouldBeTrue)
+		config.Set(mainnet)
+		So(AddTx(testSpend(1, 1, 50000, 2000, testnet), db), ShouldEqual, transaction.ErrBadAddress)
+
+		So(AddTx(testSpend(1, 1, 50000, 2000, someone), db), ShouldBeNil)
+	})
+}
+
+func TestDeleteBlock(t *testing.T) {
+	Convey("Undo records put accounts back as they were", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		before := *account(db, tools.MakeAddress(first.Txs[0].PubKeys, 1))
+
+		block := nextBlock(db, first, testMint(1))
+		So(AddBlock(block, db), ShouldBeNil)
+		So(DeleteBlock(db), ShouldBeNil)
+		So(db.Length, ShouldEqual, 1)
+		So(*account(db, tools.MakeAddress(first.Txs[0].PubKeys, 1)), ShouldResemble, before)
+		So(db.GetUndo(2), ShouldBeNil)
+
+		// Only the premine is left.
+		So(DeleteBlock(db), ShouldBeNil)
+		accounts := 0
+		db.ForEachAccount(func(string, *types.Account) error { accounts++; return nil })
+		So(accounts, ShouldEqual, len(config.Get().Premine))
+	})
+
+	Convey("Blocks without undo records can't be disconnected", t, func() {
+		db := newTestDB()
+		So(AddBlock(nextBlock(db, db.GetBlock(0), testMint(1)), db), ShouldBeNil)
+		So(db.DeleteUndo(1), ShouldBeNil)
+		So(DeleteBlock(db), ShouldEqual, ErrNoUndo)
+		So(db.Length, ShouldEqual, 1)
+	})
+}
+
+func TestAtomicWrites(t *testing.T) {
+	Convey("The stored tip follows the chain", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		block := nextBlock(db, first, testMint(1))
+		So(AddBlock(block, db), ShouldBeNil)
+		So(*db.GetTip(), ShouldResemble, types.Tip{Length: 2, Hash: tools.DetHash(block), DiffLength: block.DiffLength})
+
+		So(DeleteBlock(db), ShouldBeNil)
+		So(db.GetTip().Hash, ShouldEqual, tools.DetHash(first))
+		So(DeleteBlock(db), ShouldBeNil)
+		So(db.GetTip().Hash, ShouldEqual, config.Get().GenesisHash)
+	})
+
+	Convey("Discarded writes never reach the disk", t, func() {
+		db := newTestDB()
+		db.Begin()
+		So(db.PutAccount("addr", &types.Account{Count: 1}), ShouldBeNil)
+		So(account(db, "addr").Count, ShouldEqual, 1)
+		db.Discard()
+		So(account(db, "addr").Count, ShouldEqual, 0)
+	})
+
+	Convey("Recover drops blocks above the tip", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		block := nextBlock(db, first, testMint(1))
+		So(db.PutBlock(block), ShouldBeNil)
+
+		So(db.Recover(), ShouldBeNil)
+		So(db.GetBlock(2), ShouldBeNil)
+		So(db.GetBlock(1), ShouldNotBeNil)
+	})
+}
+
+func TestOpenChain(t *testing.T) {
+	Convey("Reopening a database picks up its tip", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		block := nextBlock(db, first, testMint(1))
+		So(AddBlock(block, db), ShouldBeNil)
+
+		reopened, err := types.OpenChain(db.Storage)
+		So(err, ShouldBeNil)
+		So(reopened.Length, ShouldEqual, 2)
+		So(reopened.DiffLength.Cmp(block.DiffLength), ShouldEqual, 0)
+	})
+
+	Convey("A tip not matching its block is refused", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		So(db.PutTip(&types.Tip{Length: 1, Hash: "00", DiffLength: first.DiffLength}), ShouldBeNil)
+
+		_, err := types.OpenChain(db.Storage)
+		So(err, ShouldEqual, types.ErrTipMismatch)
+	})
+}
+
+func TestTxIndex(t *testing.T) {
+	Convey("Mined txs can be found by hash until disconnected", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		block := nextBlock(db, first, testMint(2))
+		So(AddBlock(block, db), ShouldBeNil)
+
+		hash := types.TxHash(block.Txs[0])
+		tx, loc := db.GetTx(hash)
+		So(tools.DetHash(tx), ShouldEqual, hash)
+		So(*loc, ShouldResemble, types.TxLocation{Height: 2, Index: 0})
+
+		So(DeleteBlock(db), ShouldBeNil)
+		tx, _ = db.GetTx(hash)
+		So(tx, ShouldBeNil)
+		tx, _ = db.GetTx(types.TxHash(first.Txs[0]))
+		So(tx, ShouldNotBeNil)
+	})
+
+	Convey("Mints to the same address are told apart by their height", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		second := nextBlock(db, first, testMint(1))
+		So(AddBlock(second, db), ShouldBeNil)
+
+		hash := types.TxHash(first.Txs[0])
+		So(types.TxHash(second.Txs[0]), ShouldNotEqual, hash)
+		_, loc := db.GetTx(types.TxHash(second.Txs[0]))
+		So(*loc, ShouldResemble, types.TxLocation{Height: 2, Index: 0})
+
+		So(DeleteBlock(db), ShouldBeNil)
+		_, loc = db.GetTx(hash)
+		So(*loc, ShouldResemble, types.TxLocation{Height: 1, Index: 0})
+
+		// Nor can they be mined at any other height.
+		mint := testMint(1)
+		block := nextBlock(db, first, mint)
+		mint.Height = 3
+		block.MerkleRoot = types.MerkleRoot(block.Txs)
+		mine(&block.BlockHeader)
+		err := AddBlock(block, db)
+		So(err, ShouldHaveSameTypeAs, &ErrTxInvalid{})
+		So(err.(*ErrTxInvalid).Reason, ShouldEqual, transaction.ErrMintHeight)
+	})
+}
+
+func TestAddressHistory(t *testing.T) {
+	Convey("Connected blocks show up in their addresses' history", t, func() {
+		db := newTestDB()
+		db.AddressIndex = true
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		block := nextBlock(db, first, testMint(1))
+		So(AddBlock(block, db), ShouldBeNil)
+
+		addr := tools.MakeAddress(first.Txs[0].PubKeys, 1)
+		history, err := db.GetHistory(addr, 0, 10)
+		So(err, ShouldBeNil)
+		So(len(history), ShouldEqual, 2)
+		So(history[0].Height, ShouldEqual, 2)
+		So(history[0].Direction, ShouldEqual, types.HistoryIn)
+
+		history, err = db.GetHistory(addr, 1, 10)
+		So(err, ShouldBeNil)
+		So(len(history), ShouldEqual, 1)
+		So(history[0].Height, ShouldEqual, 1)
+
+		So(DeleteBlock(db), ShouldBeNil)
+		history, err = db.GetHistory(addr, 0, 10)
+		So(err, ShouldBeNil)
+		So(len(history), ShouldEqual, 1)
+	})
+}
+
+func TestFees(t *testing.T) {
+	Convey("Fees go from the sender to the block's miner", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+
+		sender := tools.MakeAddress(first.Txs[0].PubKeys, 1)
+		spend := testSpend(1, 1, 50000, 2000, someone)
+		So(AddTx(spend, db), ShouldBeNil)
+
+		mint := testMint(2)
+		block := nextBlock(db, first, spend, mint)
+		So(AddBlock(block, db), ShouldResemble, &ErrTxInvalid{Index: 1, Reason: transaction.ErrBadMintAmount})
+
+		mint.Amount += 2000
+		block = nextBlock(db, first, spend, mint)
+		So(AddBlock(block, db), ShouldBeNil)
+		So(account(db, sender).Amount, ShouldEqual, config.Get().BlockReward-52000)
+		So(account(db, someone).Amount, ShouldEqual, 50000)
+		So(account(db, tools.MakeAddress(mint.PubKeys, 1)).Amount, ShouldEqual, config.Get().BlockReward+2000)
+		So(db.Pool.Len(), ShouldEqual, 0)
+	})
+
+	Convey("Spends must pay at least MinFee", t, func() {
+		db := newTestDB()
+		So(AddBlock(nextBlock(db, db.GetBlock(0), testMint(1)), db), ShouldBeNil)
+		So(AddTx(testSpend(1, 1, 50000, config.Get().MinFee-1, someone), db), ShouldEqual, transaction.ErrFeeTooLow)
+	})
+}
+
+func TestReplaceTx(t *testing.T) {
+	Convey("Pending spends can be replaced by better paying ones", t, func() {
+		db := newTestDB()
+		So(AddBlock(nextBlock(db, db.GetBlock(0), testMint(1)), db), ShouldBeNil)
+
+		spend := testSpend(1, 1, 50000, 2000, someone)
+		So(AddTx(spend, db), ShouldBeNil)
+		So(AddTx(testSpend(1, 1, 50000, 2500, someone), db), ShouldEqual, mempool.ErrReplaceFee)
+
+		// All but the fee comes back to the sender.
+		cancel := testSpend(1, 1, 1, 3000, tools.MakeAddress(spend.PubKeys, 1))
+		So(AddTx(cancel, db), ShouldBeNil)
+		So(db.Pool.Txs(), ShouldResemble, []*types.Tx{cancel})
+
+		// Replacements must still be affordable.
+		So(AddTx(testSpend(1, 1, 1, config.Get().BlockReward, someone), db), ShouldEqual, transaction.ErrInsufficientFunds)
+
+		// Once either is mined the other is spent for good.
+		mint := testMint(2)
+		mint.Amount += 2000
+		second := nextBlock(db, db.GetBlock(1), spend, mint)
+		So(AddBlock(second, db), ShouldBeNil)
+		mint = testMint(2)
+		mint.Amount += 3000
+		err := AddBlock(nextBlock(db, second, cancel, mint), db)
+		So(err, ShouldHaveSameTypeAs, &ErrTxInvalid{})
+		So(err.(*ErrTxInvalid).Reason, ShouldEqual, ErrTxCount)
+	})
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	Convey("Blocks, txs and reads can come from many goroutines at once", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		sender := tools.MakeAddress(first.Txs[0].PubKeys, 1)
+		block := nextBlock(db, first, testMint(2))
+
+		var wg sync.WaitGroup
+		run := func(fn func()) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				fn()
+			}()
+		}
+		run(func() { ProcessBlock(block, db) })
+		for i := 1; i <= 5; i++ {
+			spend := testSpend(1, i, 1000, 2000, someone)
+			run(func() { AddTx(spend, db) })
+		}
+		for i := 0; i < 5; i++ {
+			run(func() { Count(sender, db) })
+			run(func() { Target(db, 2) })
+			run(func() {
+				db.RLock()
+				defer db.RUnlock()
+				db.GetBlock(db.Length)
+				account(db, sender)
+			})
+		}
+		wg.Wait()
+
+		So(db.Length, ShouldEqual, 2)
+		So(db.GetTip().Hash, ShouldEqual, config.Hash(block.Hash()))
+	})
+}
+
+func TestHeaderCache(t *testing.T) {
+	Convey("Every chain caches its own headers", t, func() {
+		db, other := newTestDB(), newTestDB()
+		a := nextBlock(db, db.GetBlock(0), testMint(1))
+		b := nextBlock(other, other.GetBlock(0), testMint(2))
+		b.Time = b.Time.Add(time.Second)
+		mine(&b.BlockHeader)
+		So(AddBlock(a, db), ShouldBeNil)
+		So(AddBlock(b, other), ShouldBeNil)
+
+		So(db.GetHeader(1).Time, ShouldResemble, a.Time)
+		So(other.GetHeader(1).Time, ShouldResemble, b.Time)
+	})
+
+	Convey("Disconnected blocks don't leave their headers behind", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		old := nextBlock(db, first, testMint(1))
+		So(AddBlock(old, db), ShouldBeNil)
+		So(db.GetHeader(2).Time.Equal(old.Time), ShouldBeTrue)
+
+		So(DeleteBlock(db), ShouldBeNil)
+		So(db.Headers.Len(), ShouldEqual, 2)
+
+		replacement := nextBlock(db, first, testMint(2))
+		replacement.Time = replacement.Time.Add(time.Second)
+		mine(&replacement.BlockHeader)
+		So(AddBlock(replacement, db), ShouldBeNil)
+		So(db.GetHeader(2).Time.Equal(replacement.Time), ShouldBeTrue)
+	})
+}
+
+func TestTarget(t *testing.T) {
+	Convey("Targets past the first blocks come from the configured algorithm", t, func() {
+		db := newTestDB()
+		parent := db.GetBlock(0)
+		for i := 0; i < 4; i++ {
+			block := nextBlock(db, parent, testMint(1))
+			So(AddBlock(block, db), ShouldBeNil)
+			parent = block
+		}
+
+		alg, err := difficulty.New(config.Get())
+		So(err, ShouldBeNil)
+		So(Target(db, 5), ShouldResemble, alg.Target(db, 5))
+		So(Target(db, 5).Cmp(difficulty.MaxTarget()), ShouldBeLessThan, 0)
+		So(Target(db, 2).Compact(), ShouldEqual, db.GetBlock(2).Bits)
+	})
+}
+
+func TestBlockTime(t *testing.T) {
+	Convey("Blocks can be up to MaxFutureDrift ahead of the clock", t, func() {
+		db := newTestDB()
+		now := time.Now()
+		db.Clock = clock.NewFixed(now)
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+
+		block := nextBlock(db, first, testMint(1))
+		block.Time = now.Add(config.Get().MaxFutureDrift + time.Second)
+		mine(&block.BlockHeader)
+		So(AddBlock(block, db), ShouldEqual, ErrTimeTooNew)
+
+		block.Time = now.Add(config.Get().MaxFutureDrift)
+		mine(&block.BlockHeader)
+		So(AddBlock(block, db), ShouldBeNil)
+	})
+
+	Convey("Blocks must be newer than the median time past", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		So(MedianTimePast(db, 2).Equal(first.Time), ShouldBeTrue)
+
+		block := nextBlock(db, first, testMint(1))
+		block.Time = first.Time
+		mine(&block.BlockHeader)
+		So(AddBlock(block, db), ShouldEqual, ErrTimeTooOld)
+	})
+}
+
+func TestGenesis(t *testing.T) {
+	Convey("Every network's genesis block is the one its params pin", t, func() {
+		for _, params := range []*config.ChainParams{config.MainNet, config.TestNet, config.RegTest} {
+			genesis := Genesis(params)
+			So(tools.DetHash(genesis), ShouldEqual, params.GenesisHash)
+			So(CheckPoW(&genesis.BlockHeader), ShouldBeTrue)
+		}
+	})
+
+	Convey("Chains can't start from another genesis", t, func() {
+		ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+		So(err, ShouldBeNil)
+		db := types.NewDB(ldb)
+		db.Pool = mempool.New(config.Get().MempoolSize, 0)
+
+		other := Genesis(config.RegTest)
+		So(AddBlock(other, db), ShouldEqual, ErrBadGenesis)
+		So(ProcessBlock(other, db), ShouldEqual, ErrBadGenesis)
+
+		So(InitChain(db), ShouldBeNil)
+		So(db.Length, ShouldEqual, 0)
+		So(InitChain(db), ShouldBeNil)
+		So(ProcessBlock(other, db), ShouldEqual, ErrBadGenesis)
+	})
+
+	Convey("Genesis pays the premine", t, func() {
+		params := *config.RegTest
+		params.Premine = []config.Allocation{
+			{Address: "alice", Amount: 30 * coin.Unit},
+			{Address: "bob", Amount: 20 * coin.Unit},
+			{Address: "alice", Amount: 5 * coin.Unit},
+		}
+		genesis := Genesis(&params)
+		mine(&genesis.BlockHeader)
+		params.GenesisNonce = genesis.Nonce.Int64()
+		params.GenesisHash = tools.DetHash(genesis)
+		So(params.GenesisHash, ShouldNotEqual, config.RegTest.GenesisHash)
+		So(params.PremineTotal(), ShouldEqual, 55*coin.Unit)
+
+		defer config.Set(config.Get())
+		config.Set(config.New(&params))
+		db := newTestDB()
+		So(account(db, "alice").Amount, ShouldEqual, 35*coin.Unit)
+		So(account(db, "bob").Amount, ShouldEqual, 20*coin.Unit)
+		So(account(db, "alice").Count, ShouldEqual, 0)
+
+		// Only genesis can pay it.
+		premine := &types.Tx{Type: "premine", To: "bob", Amount: coin.Unit}
+		So(AddTx(premine, db), ShouldEqual, ErrTxType)
+		block := nextBlock(db, db.GetBlock(0), premine)
+		So(AddBlock(block, db), ShouldResemble, &ErrTxInvalid{Index: 0, Reason: transaction.ErrLatePremine})
+	})
+
+	Convey("Chains of another network are refused", t, func() {
+		defer config.Set(config.Get())
+		db := newTestDB()
+
+		config.Set(config.New(config.TestNet))
+		So(InitChain(db), ShouldEqual, ErrBadGenesis)
+	})
+
+	Convey("Genesis is connected the way altcoind starts up", t, func() {
+		// RegTest has a premine to look for in the history.
+		defer config.Set(config.Get())
+		config.Set(config.New(config.RegTest))
+		open := func() *types.DB {
+			ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+			So(err, ShouldBeNil)
+			return types.NewDB(ldb)
+		}
+
+		// Before there's a pool, blocks come and go all the same.
+		db := open()
+		So(InitChain(db), ShouldBeNil)
+		So(AddBlock(nextBlock(db, db.GetBlock(0), testMint(1)), db), ShouldBeNil)
+		So(DeleteBlock(db), ShouldBeNil)
+
+		db = open()
+		db.AddressIndex = true
+		db.Pool = mempool.New(config.Get().MempoolSize, 0)
+		So(InitChain(db), ShouldBeNil)
+		So(config.Get().Premine, ShouldNotBeEmpty)
+		for _, a := range config.Get().Premine {
+			entries, err := db.GetHistory(a.Address, 0, 10)
+			So(err, ShouldBeNil)
+			So(len(entries), ShouldEqual, 1)
+			So(entries[0].Amount, ShouldEqual, a.Amount)
+		}
+	})
+}
+
+func TestMaturity(t *testing.T) {
+	Convey("Rewards can't be spent until CoinbaseMaturity blocks are on top", t, func() {
+		defer config.Set(config.Get())
+		params := *config.Get().ChainParams
+		params.CoinbaseMaturity = 2
+		config.Set(config.New(&params))
+
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		addr := tools.MakeAddress(first.Txs[0].PubKeys, 1)
+		So(account(db, addr).Amount, ShouldEqual, config.Get().BlockReward)
+		immature, err := account(db, addr).Immature(2)
+		So(err, ShouldBeNil)
+		So(immature, ShouldEqual, config.Get().BlockReward)
+
+		spend := testSpend(1, 1, 50000, 2000, someone)
+		So(AddTx(spend, db), ShouldEqual, transaction.ErrInsufficientFunds)
+
+		// Not even by the next block's own mint.
+		mint := testMint(1)
+		block := nextBlock(db, first, spend, mint)
+		err = AddBlock(block, db)
+		So(err, ShouldHaveSameTypeAs, &ErrTxInvalid{})
+		So(err.(*ErrTxInvalid).Reason, ShouldEqual, transaction.ErrInsufficientFunds)
+
+		second := nextBlock(db, first, testMint(1))
+		So(AddBlock(second, db), ShouldBeNil)
+		spendable, err := account(db, addr).Spendable(3)
+		So(err, ShouldBeNil)
+		So(spendable, ShouldEqual, config.Get().BlockReward)
+		immature, err = account(db, addr).Immature(3)
+		So(err, ShouldBeNil)
+		So(immature, ShouldEqual, config.Get().BlockReward)
+		// Mints count as txs of their address too.
+		So(AddTx(testSpend(1, 2, 50000, 2000, someone), db), ShouldBeNil)
+
+		// Matured rewards aren't tracked anymore.
+		So(AddBlock(nextBlock(db, second, testMint(1)), db), ShouldBeNil)
+		So(len(account(db, addr).Maturing), ShouldEqual, 2)
+
+		// Going back locks them again.
+		So(DeleteBlock(db), ShouldBeNil)
+		So(DeleteBlock(db), ShouldBeNil)
+		So(AddTx(testSpend(1, 1, 50000, 3000, someone), db), ShouldEqual, transaction.ErrInsufficientFunds)
+	})
+}
+
+func TestMultisig(t *testing.T) {
+	Convey("M of N addresses spend once M of their keys sign", t, func() {
+		var privs []*btcec.PrivateKey
+		var pubs []*btcec.PublicKey
+		for i := 0; i < 3; i++ {
+			priv, pub := tools.ParseKeyPair(tools.DetHashInt(10 + i))
+			privs = append(privs, priv)
+			pubs = append(pubs, pub)
+		}
+		addr := tools.MakeAddress(pubs, 2)
+
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(AddBlock(first, db), ShouldBeNil)
+		mint := testMint(2)
+		mint.Amount += 2000
+		second := nextBlock(db, first, testSpend(1, 1, 50000, 2000, addr), mint)
+		So(AddBlock(second, db), ShouldBeNil)
+		So(account(db, addr).Amount, ShouldEqual, 50000)
+
+		tx := transaction.NewSpend(pubs, 2, 0, 20000, 2000, someone)
+		alice, bob := *tx, *tx
+		So(transaction.Sign(&alice, privs[0]), ShouldBeNil)
+		So(transaction.Sign(&bob, privs[2]), ShouldBeNil)
+		So(transaction.MissingSignatures(&alice), ShouldEqual, 1)
+		So(AddTx(&alice, db), ShouldEqual, transaction.ErrBadSignature)
+
+		// Nor is alice's signature good for the 1 of 3 address.
+		single := alice
+		single.Signatures = alice.Signatures[:1]
+		So(AddTx(&single, db), ShouldEqual, transaction.ErrBadSignature)
+
+		foreign, _ := tools.ParseKeyPair(tools.DetHashInt(20))
+		So(transaction.Sign(&bob, foreign), ShouldEqual, transaction.ErrNotOurKey)
+
+		// Bob's copy is signed out of key order, Combine sorts them out.
+		signed, err := transaction.Combine(&bob, &alice)
+		So(err, ShouldBeNil)
+		So(transaction.MissingSignatures(signed), ShouldEqual, 0)
+		So(transaction.Sign(signed, privs[1]), ShouldEqual, transaction.ErrFullySigned)
+		So(AddTx(signed, db), ShouldBeNil)
+
+		other := transaction.NewSpend(pubs, 2, 0, 20000, 2000, tools.MakeAddress(pubs, 1))
+		_, err = transaction.Combine(signed, other)
+		So(err, ShouldEqual, transaction.ErrDifferentTxs)
+		other.Signatures = nil
+		So(AddTx(other, db), ShouldEqual, transaction.ErrNoSignatures)
+	})
+}
@@ -6,18 +6,46 @@ import (
 )
 
 // Returns the number of transactions that pubkey has broadcast.
-func Count(addr string, db *types.DB) int {
+func Count(addr string, db *types.DB) (int, error) {
+	db.RLock()
+	defer db.RUnlock()
+
+	return countLocked(addr, db)
+}
+
+func countLocked(addr string, db *types.DB) (int, error) {
 	// def zeroth_confirmation_txs(address, DB):
 	// 	def is_zero_conf(t):
 	// 		return address == tools.make_address(t['pubkeys'], len(t['signatures']))
 	// return len(filter(is_zero_conf, DB['txs']))
-	var zerothConfirmationTxs int
-	for _, t := range db.Txs {
-		if addr == tools.MakeAddress(t.PubKeys, len(t.Signatures)) {
-			zerothConfirmationTxs++
-		}
+	zerothConfirmationTxs := db.Pool.Count(addr)
+
+	current, err := db.GetAccount(addr)
+	if err != nil {
+		return 0, err
 	}
+	return current.Count + zerothConfirmationTxs, nil
+}
 
-	current := db.GetAccount(addr)
-	return current.Count + zerothConfirmationTxs
+// checkCount tells whether tx is the next tx of its sender in a block, after
+// the ones before it. Otherwise a mined spend could be paid twice, or a
+// replacement of it mined after the original.
+func checkCount(tx *types.Tx, before []*types.Tx, db *types.DB) error {
+	addr := tools.MakeAddress(tx.PubKeys, len(tx.Signatures))
+	acc, err := db.GetAccount(addr)
+	if err != nil {
+		return err
+	}
+
+	// Mints count too, see transaction.Mint.
+	count := acc.Count
+	for _, t := range before {
+		if t.Type != "premine" && tools.MakeAddress(t.PubKeys, len(t.Signatures)) == addr {
+			count++
+		}
+	}
+	if tx.Count != count {
+		return ErrTxCount
+	}
+	return nil
 }
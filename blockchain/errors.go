@@ -0,0 +1,53 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reasons for AddBlock to reject a block.
+var (
+	ErrBlockError     = errors.New("block: carries an error")
+	ErrBadLength      = errors.New("block: length doesn't follow our tip")
+	ErrBadGenesis     = errors.New("block: genesis isn't our network's")
+	ErrBadTarget      = errors.New("block: missing or malformed target")
+	ErrBadDiffLength  = errors.New("block: difflength doesn't match our chain")
+	ErrBadPrevHash    = errors.New("block: prevhash isn't our tip")
+	ErrBadPoW         = errors.New("block: hash doesn't meet its target")
+	ErrTargetMismatch = errors.New("block: target isn't the expected difficulty")
+	ErrTimeTooOld     = errors.New("block: time isn't after the median of recent blocks")
+	ErrTimeTooNew     = errors.New("block: time is too far in the future")
+	ErrBadMerkleRoot  = errors.New("block: merkle root doesn't match its txs")
+	ErrBlockTooBig    = errors.New("block: txs are bigger than MaxBlockSize")
+)
+
+// Reasons for ProcessBlock to ignore a block.
+var (
+	ErrBlockKnown   = errors.New("block: already known")
+	ErrOrphan       = errors.New("block: parent is unknown")
+	ErrReorgTooDeep = errors.New("block: branch forks deeper than MaxReorgDepth")
+	ErrNoUndo       = errors.New("block: no undo record, can't disconnect it")
+	ErrEasyTarget   = errors.New("block: target is easier than MaxBits")
+	ErrIndexFull    = errors.New("block: side branches with more work fill the index")
+)
+
+// Reasons for AddTx to reject a tx, also used as ErrTxInvalid.Reason.
+var (
+	ErrTxType      = errors.New("tx: unknown or disallowed type")
+	ErrTxDuplicate = errors.New("tx: already in the pool")
+	ErrTxCount     = errors.New("tx: count isn't the next one for its address")
+	ErrTxTooBig    = errors.New("tx: doesn't fit in a block")
+)
+
+// ErrTxInvalid is returned by AddBlock when the tx at Index fails verification.
+type ErrTxInvalid struct {
+	Index  int
+	Reason error
+}
+
+func (e *ErrTxInvalid) Error() string {
+	return fmt.Sprintf("block: tx %d is invalid: %v", e.Index, e.Reason)
+}
+
+// Unwrap returns Reason so errors.Is can look through it.
+func (e *ErrTxInvalid) Unwrap() error { return e.Reason }
@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"math/big"
+
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/tools"
+	"github.com/toqueteos/altcoin/types"
+)
+
+// Genesis builds the first block of the network params describes out of its
+// Genesis* fields, every node of the network builds the same one.
+//
+// Nobody mines it so it has no mint, its txs pay the Premine. It has no parent
+// either, its PrevHash carries GenesisMessage instead, the way Bitcoin's
+// carries a headline in its coinbase.
+func Genesis(params *config.ChainParams) *types.Block {
+	var txs []*types.Tx
+	for _, a := range params.Premine {
+		txs = append(txs, &types.Tx{Type: "premine", To: a.Address, Amount: a.Amount})
+	}
+
+	// A broken MaxBits gives a header with a bad target, which is refused
+	// like any other.
+	bits, work := params.MaxBits, types.NewWork(0)
+	if target, err := types.TargetFromCompact(bits); err == nil {
+		work = target.Work()
+	}
+
+	return &types.Block{
+		BlockHeader: types.BlockHeader{
+			PrevHash:   params.GenesisMessage,
+			MerkleRoot: types.MerkleRoot(txs),
+			Time:       params.GenesisTime,
+			Bits:       bits,
+			DiffLength: work,
+			Nonce:      big.NewInt(params.GenesisNonce),
+		},
+		Length: 0,
+		Txs:    txs,
+	}
+}
+
+// InitChain starts an empty chain with the genesis block of the configured
+// network. Chains that aren't empty must start with it already, otherwise
+// they're from another network and ErrBadGenesis is returned.
+func InitChain(db *types.DB) error {
+	db.Lock()
+	defer db.Unlock()
+
+	if db.Length >= 0 {
+		if !isGenesis(tools.DetHash(db.GetBlock(0))) {
+			return ErrBadGenesis
+		}
+		return nil
+	}
+	return addBlockLocked(Genesis(config.Get().ChainParams), db)
+}
+
+// isGenesis reports whether hash is the one of the configured network's
+// genesis block.
+func isGenesis(hash string) bool {
+	return hash == config.Get().GenesisHash
+}
@@ -0,0 +1,197 @@
+package blockchain
+
+import (
+	"log"
+
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/difficulty"
+	"github.com/toqueteos/altcoin/tools"
+	"github.com/toqueteos/altcoin/types"
+)
+
+// ProcessBlock is how blocks from peers and miners get into the chain.
+// Blocks on top of our tip are added right away, blocks on a competing branch
+// are kept in db.Index and, once their branch has more cumulative difficulty
+// (DiffLength) than ours, we reorganize to it.
+func ProcessBlock(block *types.Block, db *types.DB) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return processBlockLocked(block, db)
+}
+
+func processBlockLocked(block *types.Block, db *types.DB) error {
+	if block.Error != nil {
+		return ErrBlockError
+	}
+
+	hash := tools.DetHash(block)
+	if db.Index.Get(hash) != nil || onMainChain(hash, block.Length, db) {
+		return ErrBlockKnown
+	}
+	// Branches can't start over from another genesis.
+	if block.Length == 0 && !isGenesis(hash) {
+		return ErrBadGenesis
+	}
+
+	// Common case, block extends our tip.
+	if block.Length == db.Length+1 && (db.Length < 0 || block.PrevHash == tools.DetHash(db.GetBlock(db.Length))) {
+		return addBlockLocked(block, db)
+	}
+
+	// Otherwise it belongs to a side branch, we need its parent to tell.
+	// Genesis is the only block without one and it's never on a side branch.
+	if block.Length < 1 {
+		return ErrBadLength
+	}
+	parent := findBlock(block.PrevHash, db)
+	if parent == nil {
+		return ErrOrphan
+	}
+	if block.Length != parent.Length+1 {
+		return ErrBadLength
+	}
+	// reorganize would refuse it anyway, no point in keeping it around.
+	if db.Length-forkLength(block, db) > config.Get().MaxReorgDepth {
+		return ErrReorgTooDeep
+	}
+
+	// Only context free checks for now, everything else is checked by AddBlock
+	// if we ever switch to this branch. Without a target of our own to compare
+	// with, MaxBits at least keeps side blocks from coming for free.
+	if err := checkDiffLength(&block.BlockHeader, parent.DiffLength); err != nil {
+		return err
+	}
+	if target, _ := block.Target(); target.Cmp(difficulty.MaxTarget()) > 0 {
+		return ErrEasyTarget
+	}
+	if !CheckPoW(&block.BlockHeader) {
+		return ErrBadPoW
+	}
+	if block.MerkleRoot != types.MerkleRoot(block.Txs) {
+		return ErrBadMerkleRoot
+	}
+
+	if err := indexBlock(hash, block, db); err != nil {
+		return err
+	}
+	if block.DiffLength.Cmp(db.DiffLength) <= 0 {
+		return nil
+	}
+
+	return reorganize(block, db)
+}
+
+// reorganize makes tip's branch the main chain. If a block on the branch turns
+// out to be invalid the branch is forgotten and our old chain is restored.
+func reorganize(tip *types.Block, db *types.DB) error {
+	// Walk back until the branch meets the main chain, branch is newest first.
+	branch := []*types.Block{tip}
+	for {
+		last := branch[len(branch)-1]
+		if last.Length == 0 || onMainChain(last.PrevHash, last.Length-1, db) {
+			break
+		}
+
+		parent := db.Index.Get(last.PrevHash)
+		if parent == nil {
+			return ErrOrphan
+		}
+		branch = append(branch, parent)
+	}
+
+	forkLength := branch[len(branch)-1].Length - 1
+	if db.Length-forkLength > config.Get().MaxReorgDepth {
+		return ErrReorgTooDeep
+	}
+
+	log.Printf("reorganize: disconnecting %d blocks, connecting %d", db.Length-forkLength, len(branch))
+
+	// Oldest first, so they can be connected again if needed.
+	var disconnected []*types.Block
+	for db.Length > forkLength {
+		tip := db.GetBlock(db.Length)
+		if err := deleteBlockLocked(db); err != nil {
+			return reconnect(disconnected, db, err)
+		}
+		disconnected = append([]*types.Block{tip}, disconnected...)
+	}
+
+	for i := len(branch) - 1; i >= 0; i-- {
+		err := addBlockLocked(branch[i], db)
+		if err == nil {
+			continue
+		}
+
+		// Forget the bad block and everything built on it.
+		db.Index.RemoveTree(tools.DetHash(branch[i]))
+		for db.Length > forkLength {
+			if err := deleteBlockLocked(db); err != nil {
+				log.Println("reorganize: couldn't disconnect bad branch:", err)
+				return err
+			}
+		}
+		return reconnect(disconnected, db, err)
+	}
+
+	return nil
+}
+
+// reconnect puts back the blocks a failed reorg disconnected and returns err.
+func reconnect(disconnected []*types.Block, db *types.DB, err error) error {
+	for _, b := range disconnected {
+		if err := addBlockLocked(b, db); err != nil {
+			log.Println("reorganize: couldn't restore block:", err)
+			break
+		}
+	}
+	return err
+}
+
+// indexBlock adds a side block to db.Index. A full index makes room by
+// dropping the side block with the least work nothing builds on, if it has less
+// than this one.
+func indexBlock(hash string, block *types.Block, db *types.DB) error {
+	db.Index.Add(hash, block)
+	if db.Index.Len() <= config.Get().MaxSideBlocks {
+		return nil
+	}
+
+	// With block in already its parent can't be picked.
+	least, b := db.Index.LeastWorkLeaf()
+	if least == hash || b.DiffLength.Cmp(block.DiffLength) >= 0 {
+		db.Index.Remove(hash)
+		return ErrIndexFull
+	}
+	db.Index.Remove(least)
+	return nil
+}
+
+// forkLength is the length of the main chain block a side block's branch
+// starts from, block itself must not be in db.Index yet.
+func forkLength(block *types.Block, db *types.DB) int {
+	for {
+		parent := db.Index.Get(block.PrevHash)
+		if parent == nil {
+			return block.Length - 1
+		}
+		block = parent
+	}
+}
+
+// onMainChain reports whether the block at length in our chain has this hash.
+func onMainChain(hash string, length int, db *types.DB) bool {
+	if length < 0 || length > db.Length {
+		return false
+	}
+	b := db.GetBlock(length)
+	return b != nil && tools.DetHash(b) == hash
+}
+
+// findBlock looks for a block by hash on the main chain or any known branch.
+func findBlock(hash string, db *types.DB) *types.Block {
+	if b := db.Index.Get(hash); b != nil {
+		return b
+	}
+	return db.GetBlockByHash(hash)
+}
@@ -0,0 +1,181 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/tools"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProcessBlock(t *testing.T) {
+	Convey("Side branches are kept until they win", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(ProcessBlock(first, db), ShouldBeNil)
+
+		a1 := nextBlock(db, first, testMint(1))
+		So(ProcessBlock(a1, db), ShouldBeNil)
+		So(ProcessBlock(a1, db), ShouldEqual, ErrBlockKnown)
+
+		b1 := nextBlock(db, first, testMint(2))
+		So(ProcessBlock(b1, db), ShouldBeNil)
+		So(tools.DetHash(db.GetBlock(2)), ShouldEqual, tools.DetHash(a1))
+
+		b2 := nextBlock(db, b1, testMint(2))
+		So(ProcessBlock(b2, db), ShouldBeNil)
+		So(db.Length, ShouldEqual, 3)
+		So(tools.DetHash(db.GetBlock(2)), ShouldEqual, tools.DetHash(b1))
+		So(db.DiffLength.Cmp(b2.DiffLength), ShouldEqual, 0)
+
+		// Rewards moved from a1's miner to b1's.
+		So(account(db, tools.MakeAddress(a1.Txs[0].PubKeys, 1)).Amount, ShouldEqual, config.Get().BlockReward)
+		So(account(db, tools.MakeAddress(b1.Txs[0].PubKeys, 1)).Amount, ShouldEqual, 2*config.Get().BlockReward)
+	})
+
+	Convey("Blocks without a known parent are orphans", t, func() {
+		db := newTestDB()
+		other := newTestDB()
+		first := nextBlock(other, other.GetBlock(0), testMint(1))
+		So(ProcessBlock(first, other), ShouldBeNil)
+
+		So(ProcessBlock(nextBlock(other, first, testMint(1)), db), ShouldEqual, ErrOrphan)
+	})
+
+	Convey("Reorgs deeper than MaxReorgDepth are refused", t, func() {
+		defer func(depth int) { config.Get().MaxReorgDepth = depth }(config.Get().MaxReorgDepth)
+		config.Get().MaxReorgDepth = 0
+
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(ProcessBlock(first, db), ShouldBeNil)
+		a1 := nextBlock(db, first, testMint(1))
+		So(ProcessBlock(a1, db), ShouldBeNil)
+
+		// Not even kept for later.
+		b1 := nextBlock(db, first, testMint(2))
+		So(ProcessBlock(b1, db), ShouldEqual, ErrReorgTooDeep)
+		So(db.Index.Len(), ShouldEqual, 0)
+		So(tools.DetHash(db.GetBlock(2)), ShouldEqual, tools.DetHash(a1))
+	})
+
+	Convey("Side blocks must follow their parent", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(ProcessBlock(first, db), ShouldBeNil)
+		So(ProcessBlock(nextBlock(db, first, testMint(1)), db), ShouldBeNil)
+
+		// Lying about its Length can't make reorganize look for another fork.
+		b1 := nextBlock(db, first, testMint(2))
+		b1.Length = 5
+		So(ProcessBlock(b1, db), ShouldEqual, ErrBadLength)
+		b1.Length = -1
+		So(ProcessBlock(b1, db), ShouldEqual, ErrBadLength)
+
+		// Targets easier than MaxBits would make them free to mine.
+		easy := nextBlock(db, first, testMint(2))
+		easy.Bits = 0x2100ffff
+		target, _ := easy.Target()
+		easy.DiffLength = first.DiffLength.Add(target.Work())
+		mine(&easy.BlockHeader)
+		So(ProcessBlock(easy, db), ShouldEqual, ErrEasyTarget)
+
+		So(db.Index.Len(), ShouldEqual, 0)
+		So(db.Length, ShouldEqual, 2)
+	})
+
+	Convey("Only side blocks we could still reorg to are kept", t, func() {
+		defer func(depth, size int) {
+			config.Get().MaxReorgDepth, config.Get().MaxSideBlocks = depth, size
+		}(config.Get().MaxReorgDepth, config.Get().MaxSideBlocks)
+		config.Get().MaxReorgDepth, config.Get().MaxSideBlocks = 2, 1
+
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(ProcessBlock(first, db), ShouldBeNil)
+		a1 := nextBlock(db, first, testMint(1))
+		So(ProcessBlock(a1, db), ShouldBeNil)
+		So(db.Index.Len(), ShouldEqual, 0)
+
+		b1 := nextBlock(db, first, testMint(2))
+		So(ProcessBlock(b1, db), ShouldBeNil)
+		So(ProcessBlock(nextBlock(db, first, testMint(3)), db), ShouldEqual, ErrIndexFull)
+
+		// Room is made for branches with more work.
+		a2 := nextBlock(db, a1, testMint(1))
+		So(ProcessBlock(a2, db), ShouldBeNil)
+		c2 := nextBlock(db, a1, testMint(3))
+		So(ProcessBlock(c2, db), ShouldBeNil)
+		So(db.Index.Get(tools.DetHash(b1)), ShouldBeNil)
+		So(db.Index.Get(tools.DetHash(c2)), ShouldNotBeNil)
+
+		// And forgotten once too deep.
+		a3 := nextBlock(db, a2, testMint(1))
+		So(ProcessBlock(a3, db), ShouldBeNil)
+		So(ProcessBlock(nextBlock(db, a3, testMint(1)), db), ShouldBeNil)
+		So(db.Index.Len(), ShouldEqual, 0)
+	})
+
+	Convey("Side blocks go before the blocks built on them", t, func() {
+		defer func(size int) { config.Get().MaxSideBlocks = size }(config.Get().MaxSideBlocks)
+		config.Get().MaxSideBlocks = 2
+
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(ProcessBlock(first, db), ShouldBeNil)
+		a1 := nextBlock(db, first, testMint(1))
+		So(ProcessBlock(a1, db), ShouldBeNil)
+		a2 := nextBlock(db, a1, testMint(1))
+		So(ProcessBlock(a2, db), ShouldBeNil)
+		So(ProcessBlock(nextBlock(db, a2, testMint(1)), db), ShouldBeNil)
+
+		b1 := nextBlock(db, first, testMint(2))
+		So(ProcessBlock(b1, db), ShouldBeNil)
+		b2 := nextBlock(db, b1, testMint(2))
+		So(ProcessBlock(b2, db), ShouldBeNil)
+
+		// b1 has the least work but b2 would be left without it.
+		c3 := nextBlock(db, a2, testMint(3))
+		So(ProcessBlock(c3, db), ShouldBeNil)
+		So(db.Index.Get(tools.DetHash(b1)), ShouldNotBeNil)
+		So(db.Index.Get(tools.DetHash(b2)), ShouldBeNil)
+		So(db.Index.Get(tools.DetHash(c3)), ShouldNotBeNil)
+	})
+
+	Convey("Disconnected blocks are bounded like any side block", t, func() {
+		defer func(size int) { config.Get().MaxSideBlocks = size }(config.Get().MaxSideBlocks)
+		config.Get().MaxSideBlocks = 1
+
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(ProcessBlock(first, db), ShouldBeNil)
+		a1 := nextBlock(db, first, testMint(1))
+		So(ProcessBlock(a1, db), ShouldBeNil)
+
+		So(DeleteBlock(db), ShouldBeNil)
+		So(db.Index.Get(tools.DetHash(a1)), ShouldNotBeNil)
+
+		// No room for first, and a1 can't be kept without it.
+		So(DeleteBlock(db), ShouldBeNil)
+		So(db.Index.Len(), ShouldEqual, 0)
+	})
+
+	Convey("Invalid branches leave our chain untouched", t, func() {
+		db := newTestDB()
+		first := nextBlock(db, db.GetBlock(0), testMint(1))
+		So(ProcessBlock(first, db), ShouldBeNil)
+		a1 := nextBlock(db, first, testMint(1))
+		So(ProcessBlock(a1, db), ShouldBeNil)
+
+		// Two mints, only caught when actually connecting the branch.
+		b1 := nextBlock(db, first, testMint(2), testMint(3))
+		So(ProcessBlock(b1, db), ShouldBeNil)
+		err := ProcessBlock(nextBlock(db, b1, testMint(2)), db)
+		So(err, ShouldHaveSameTypeAs, &ErrTxInvalid{})
+
+		So(db.Length, ShouldEqual, 2)
+		So(tools.DetHash(db.GetBlock(2)), ShouldEqual, tools.DetHash(a1))
+		So(db.Index.Get(tools.DetHash(b1)), ShouldBeNil)
+	})
+}
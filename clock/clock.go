@@ -0,0 +1,119 @@
+// Package clock tells the time to everything deciding whether a block's time
+// is acceptable, so tests can control it and nodes can agree on it with their
+// peers.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the local clock.
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Fixed only moves when told to, it's safe for concurrent use.
+type Fixed struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFixed(now time.Time) *Fixed { return &Fixed{now: now} }
+
+func (c *Fixed) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *Fixed) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+func (c *Fixed) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// MinSamples is how many peers must have told us their time before we trust
+// the median of their offsets.
+const MinSamples = 5
+
+// Network is a clock adjusted by the median of how far ahead or behind peers'
+// clocks are, so one node with a wrong clock doesn't reject the blocks everybody
+// else accepts. Like Bitcoin it ignores the peers until there are MinSamples of
+// them, and ignores the median if it's further than maxOffset from the base
+// clock, being so far off is more likely an attack than a broken local clock.
+//
+// It's safe for concurrent use.
+type Network struct {
+	base      Clock
+	maxOffset time.Duration
+
+	mu      sync.Mutex
+	offsets map[string]time.Duration // Latest offset of each peer.
+}
+
+func NewNetwork(base Clock, maxOffset time.Duration) *Network {
+	return &Network{
+		base:      base,
+		maxOffset: maxOffset,
+		offsets:   make(map[string]time.Duration),
+	}
+}
+
+// AddSample records that peer's clock said peerTime when ours was between
+// sent and received, the time it took to ask.
+func (c *Network) AddSample(peer string, peerTime, sent, received time.Time) {
+	// Assume the answer took as long to come as the question to go.
+	ours := sent.Add(received.Sub(sent) / 2)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.offsets[peer] = peerTime.Sub(ours)
+}
+
+// Offset is how much Now is adjusted from the base clock.
+func (c *Network) Offset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.offsets) < MinSamples {
+		return 0
+	}
+
+	offsets := make([]time.Duration, 0, len(c.offsets))
+	for _, offset := range c.offsets {
+		offsets = append(offsets, offset)
+	}
+	sort.Sort(byDuration(offsets))
+
+	median := offsets[len(offsets)/2]
+	if median > c.maxOffset || median < -c.maxOffset {
+		return 0
+	}
+	return median
+}
+
+func (c *Network) Now() time.Time { return c.base.Now().Add(c.Offset()) }
+
+type byDuration []time.Duration
+
+func (s byDuration) Len() int           { return len(s) }
+func (s byDuration) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byDuration) Less(i, j int) bool { return s[i] < s[j] }
@@ -0,0 +1,41 @@
+package clock
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNetwork(t *testing.T) {
+	now := time.Unix(1400000000, 0)
+
+	Convey("The median peer offset adjusts the time", t, func() {
+		c := NewNetwork(NewFixed(now), time.Hour)
+		for i := 0; i < MinSamples-1; i++ {
+			c.AddSample(strconv.Itoa(i), now.Add(time.Minute), now, now)
+		}
+		So(c.Now(), ShouldResemble, now)
+
+		c.AddSample("last", now.Add(time.Hour), now.Add(-time.Second), now.Add(time.Second))
+		So(c.Offset(), ShouldEqual, time.Minute)
+		So(c.Now(), ShouldResemble, now.Add(time.Minute))
+	})
+
+	Convey("Peers can't move the time further than maxOffset", t, func() {
+		c := NewNetwork(NewFixed(now), time.Hour)
+		for i := 0; i < MinSamples; i++ {
+			c.AddSample(strconv.Itoa(i), now.Add(2*time.Hour), now, now)
+		}
+		So(c.Offset(), ShouldEqual, 0)
+	})
+
+	Convey("Each peer only counts once", t, func() {
+		c := NewNetwork(NewFixed(now), time.Hour)
+		for i := 0; i < MinSamples; i++ {
+			c.AddSample("same", now.Add(time.Minute), now, now)
+		}
+		So(c.Offset(), ShouldEqual, 0)
+	})
+}
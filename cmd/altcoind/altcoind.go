@@ -1,14 +1,19 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 
+	"github.com/toqueteos/altcoin/blockchain"
+	"github.com/toqueteos/altcoin/clock"
 	"github.com/toqueteos/altcoin/config"
 	"github.com/toqueteos/altcoin/consensus"
+	"github.com/toqueteos/altcoin/difficulty"
 	"github.com/toqueteos/altcoin/gui"
+	"github.com/toqueteos/altcoin/mempool"
 	"github.com/toqueteos/altcoin/miner"
 	"github.com/toqueteos/altcoin/server"
 	"github.com/toqueteos/altcoin/tools"
@@ -17,41 +22,74 @@ import (
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
+var WalletPassphrase = "my-altcoin-coin-wallet"
+
 var (
-	DatabaseFile     = "altcoin.db"
-	WalletPassphrase = "my-altcoin-coin-wallet"
+	network = flag.String("network", config.MainNet.Name, "network to join: mainnet, testnet or regtest")
+	testnet = flag.Bool("testnet", false, "same as -network testnet")
+	regtest = flag.Bool("regtest", false, "same as -network regtest")
 )
 
 func main() {
+	flag.Parse()
 	logger := log.New(os.Stdout, "[altcoind] ", log.Ldate|log.Ltime)
 
-	// Create/Open a LevelDB database
-	ldb, err := leveldb.OpenFile(DatabaseFile, nil)
+	name := *network
+	switch {
+	case *testnet && *regtest:
+		logger.Fatalln("-testnet and -regtest can't be used together")
+	case *testnet:
+		name = config.TestNet.Name
+	case *regtest:
+		name = config.RegTest.Name
+	}
+	params, err := config.Network(name)
 	if err != nil {
-		logger.Fatalf("Couldn't open %q\n", DatabaseFile)
+		logger.Fatalln(err)
+	}
+
+	// Let's setup ourselves as an altcoin node...
+	cfg := config.New(params)
+	cfg.Version = "ALCv1.0"
+	config.Set(cfg)
+
+	if _, err := difficulty.New(cfg); err != nil {
+		logger.Fatalln(err, "- pick one of", difficulty.Names())
+	}
+	logger.Println("Network:", cfg.Name)
+
+	// Create/Open a LevelDB database, each network keeps its own.
+	ldb, err := leveldb.OpenFile(cfg.DatabaseFile, nil)
+	if err != nil {
+		logger.Fatalf("Couldn't open %q\n", cfg.DatabaseFile)
 	}
 
 	// Create a *types.DB instance, this struct is passed around almost everywhere.
 	// It holds a pointer to the LevelDB database among other things.
-	db := types.NewDB(ldb)
+	// The chain is picked up where the last run left it.
+	db, err := types.OpenChain(ldb)
+	if err != nil {
+		logger.Fatalln("Couldn't load the blockchain:", err)
+	}
+	// The GUI lists the wallet's payments, the premine ones included.
+	db.AddressIndex = true
+	db.Pool = mempool.New(config.Get().MempoolSize, config.Get().MempoolExpiry)
 
-	// List of peers we want to connect
-	peers := []string{
-		"localhost:8901",
-		"localhost:8902",
-		"localhost:8903",
-		"localhost:8904",
-		"localhost:8905",
+	// New chains start from our network's genesis block.
+	if err := blockchain.InitChain(db); err != nil {
+		logger.Fatalf("Couldn't use %q: %v\n", cfg.DatabaseFile, err)
 	}
+	logger.Println("Blockchain length:", db.Length)
+
+	// List of peers we want to connect
+	peers := cfg.Peers
 
 	//
 	privkey := tools.DetHashString(WalletPassphrase)
 	_, rewardAddress := tools.ParseKeyPair(privkey)
 
-	// Let's setup ourselves as an altcoin node...
-	cfg := config.DefaultConfig
-	cfg.Version = "ALCv1.0"
-	config.Set(cfg)
+	// Block times are checked against the time our peers agree on.
+	db.Clock = clock.NewNetwork(clock.System, cfg.MaxClockOffset)
 
 	// Setup done, now let's init the services and call it a day...
 	go consensus.Run(db, peers)
@@ -0,0 +1,252 @@
+// multisig makes, signs and sends txs spending from M of N addresses.
+//
+// Txs travel between signers as hex of their canonical encoding:
+//
+//	multisig pubkey -wallet "my passphrase"
+//	multisig address -m 2 PUBKEY PUBKEY PUBKEY
+//	multisig create -m 2 -count 0 -amount 1.5 -fee 0.01 -to ADDRESS PUBKEY PUBKEY PUBKEY > tx
+//	multisig sign -wallet "my passphrase" $(cat tx) > tx.alice
+//	multisig sign -wallet "another passphrase" $(cat tx) > tx.bob
+//	multisig combine $(cat tx.alice) $(cat tx.bob) > tx.signed
+//	multisig send -peer localhost:10022 $(cat tx.signed)
+//
+// Wallets are the passphrases the GUI takes.
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/toqueteos/altcoin/coin"
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/server"
+	"github.com/toqueteos/altcoin/tools"
+	"github.com/toqueteos/altcoin/transaction"
+	"github.com/toqueteos/altcoin/types"
+
+	"github.com/conformal/btcec"
+)
+
+var commands = map[string]func(args []string) error{
+	"pubkey":  pubkey,
+	"address": address,
+	"create":  create,
+	"sign":    sign,
+	"combine": combine,
+	"send":    send,
+}
+
+func main() {
+	if len(os.Args) < 2 || commands[os.Args[1]] == nil {
+		fmt.Fprintln(os.Stderr, "usage: multisig pubkey|address|create|sign|combine|send [flags] [args]")
+		os.Exit(2)
+	}
+	if err := commands[os.Args[1]](os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "multisig:", err)
+		os.Exit(1)
+	}
+}
+
+// newFlags returns the flags of command, every command needs the network
+// since addresses and peers depend on it.
+func newFlags(command string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	network := fs.String("network", config.MainNet.Name, "network: mainnet, testnet or regtest")
+	return fs, network
+}
+
+func parse(fs *flag.FlagSet, network *string, args []string) error {
+	fs.Parse(args)
+	params, err := config.Network(*network)
+	if err != nil {
+		return err
+	}
+	cfg := config.New(params)
+	cfg.Version = "ALCv1.0"
+	config.Set(cfg)
+	return nil
+}
+
+func pubkey(args []string) error {
+	fs, network := newFlags("pubkey")
+	wallet := fs.String("wallet", "", "passphrase of the wallet")
+	if err := parse(fs, network, args); err != nil {
+		return err
+	}
+
+	_, pub := tools.ParseKeyPair(tools.DetHashString(*wallet))
+	fmt.Println(hex.EncodeToString(pub.SerializeCompressed()))
+	return nil
+}
+
+func address(args []string) error {
+	fs, network := newFlags("address")
+	m := fs.Int("m", 1, "signatures needed to spend")
+	if err := parse(fs, network, args); err != nil {
+		return err
+	}
+
+	pubkeys, err := parsePubKeys(fs.Args(), *m)
+	if err != nil {
+		return err
+	}
+	fmt.Println(tools.MakeAddress(pubkeys, *m))
+	return nil
+}
+
+func create(args []string) error {
+	fs, network := newFlags("create")
+	var (
+		m      = fs.Int("m", 1, "signatures needed to spend")
+		count  = fs.Int("count", 0, "count of the address spending, as its account shows")
+		amount = fs.String("amount", "", "coins to send")
+		fee    = fs.String("fee", "", "coins paid to the miner")
+		to     = fs.String("to", "", "address to send to")
+	)
+	if err := parse(fs, network, args); err != nil {
+		return err
+	}
+
+	if !tools.ValidAddress(*to) {
+		return fmt.Errorf("%q isn't a %s address", *to, config.Get().Name)
+	}
+	pubkeys, err := parsePubKeys(fs.Args(), *m)
+	if err != nil {
+		return err
+	}
+	a, err := coin.ParseAmount(*amount)
+	if err != nil {
+		return err
+	}
+	f, err := coin.ParseAmount(*fee)
+	if err != nil {
+		return err
+	}
+
+	tx := transaction.NewSpend(pubkeys, *m, *count, a, f, *to)
+	fmt.Fprintln(os.Stderr, "From:", tools.MakeAddress(pubkeys, *m))
+	return printTx(tx)
+}
+
+func sign(args []string) error {
+	fs, network := newFlags("sign")
+	wallet := fs.String("wallet", "", "passphrase of the wallet")
+	if err := parse(fs, network, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("sign takes one tx")
+	}
+
+	tx, err := parseTx(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	privkey, _ := tools.ParseKeyPair(tools.DetHashString(*wallet))
+	if err := transaction.Sign(tx, privkey); err != nil {
+		return err
+	}
+	return printTx(tx)
+}
+
+func combine(args []string) error {
+	fs, network := newFlags("combine")
+	if err := parse(fs, network, args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return errors.New("combine takes at least one tx")
+	}
+
+	var txs []*types.Tx
+	for _, arg := range fs.Args() {
+		tx, err := parseTx(arg)
+		if err != nil {
+			return err
+		}
+		txs = append(txs, tx)
+	}
+	tx, err := transaction.Combine(txs[0], txs[1:]...)
+	if err != nil {
+		return err
+	}
+	return printTx(tx)
+}
+
+func send(args []string) error {
+	fs, network := newFlags("send")
+	peer := fs.String("peer", "", "node to send the tx to, host:port")
+	if err := parse(fs, network, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("send takes one tx")
+	}
+	if *peer == "" {
+		*peer = fmt.Sprintf("localhost:%d", config.Get().ListenPort)
+	}
+
+	tx, err := parseTx(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if n := transaction.MissingSignatures(tx); n > 0 {
+		return fmt.Errorf("tx still needs %d signatures", n)
+	}
+
+	resp, err := server.SendCommand(*peer, &server.Request{Type: "PushTx", Tx: tx})
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	fmt.Println(types.TxHash(tx))
+	return nil
+}
+
+func parsePubKeys(args []string, m int) ([]*btcec.PublicKey, error) {
+	if m < 1 || m > len(args) {
+		return nil, fmt.Errorf("need at least %d pubkeys for -m %d", m, m)
+	}
+
+	var pubkeys []*btcec.PublicKey
+	for _, arg := range args {
+		b, err := hex.DecodeString(arg)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := btcec.ParsePubKey(b, btcec.S256())
+		if err != nil {
+			return nil, err
+		}
+		pubkeys = append(pubkeys, pub)
+	}
+	return pubkeys, nil
+}
+
+func parseTx(s string) (*types.Tx, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	tx := new(types.Tx)
+	if err := tx.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// printTx writes tx for the next signer, and how many more there must be.
+func printTx(tx *types.Tx) error {
+	b, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	fmt.Println(hex.EncodeToString(b))
+	fmt.Fprintln(os.Stderr, "Signatures missing:", transaction.MissingSignatures(tx))
+	return nil
+}
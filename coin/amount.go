@@ -0,0 +1,149 @@
+// Package coin defines Amount, the type every quantity of money is expressed in.
+package coin
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Decimals is how many decimal places one coin is divided into.
+const Decimals = 5
+
+const (
+	// Unit is one whole coin expressed in base units.
+	Unit Amount = 100000
+	// MaxAmount is the biggest balance, tx amount or reward we can represent.
+	MaxAmount Amount = math.MaxInt64
+)
+
+var (
+	ErrOverflow = errors.New("coin: amount overflow")
+	ErrNegative = errors.New("coin: negative amount")
+	ErrSyntax   = errors.New("coin: invalid amount")
+)
+
+// Amount is a fixed-point quantity of coins counted in base units,
+// there are Unit base units per coin.
+//
+// Amounts are never negative once they are part of a balance, tx or block,
+// Add and Sub enforce that and catch overflows instead of wrapping around.
+type Amount int64
+
+// Add returns a+b or an error if the result overflows or is negative.
+func (a Amount) Add(b Amount) (Amount, error) {
+	if (b > 0 && a > MaxAmount-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, ErrOverflow
+	}
+	if a+b < 0 {
+		return 0, ErrNegative
+	}
+	return a + b, nil
+}
+
+// Sub returns a-b or an error if the result overflows or is negative.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b == math.MinInt64 {
+		return 0, ErrOverflow
+	}
+	return a.Add(-b)
+}
+
+// Mul returns a*n or an error if the result overflows or is negative.
+func (a Amount) Mul(n int64) (Amount, error) {
+	switch {
+	case a == 0 || n == 0:
+		return 0, nil
+	case (a < 0) != (n < 0):
+		return 0, ErrNegative
+	case a == math.MinInt64 || n == math.MinInt64:
+		return 0, ErrOverflow
+	case a < 0:
+		a, n = -a, -n
+	}
+	if a > MaxAmount/Amount(n) {
+		return 0, ErrOverflow
+	}
+	return a * Amount(n), nil
+}
+
+// Sum adds up all amounts, stopping at the first error.
+func Sum(amounts ...Amount) (Amount, error) {
+	var total Amount
+	for _, a := range amounts {
+		var err error
+		if total, err = total.Add(a); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// String formats a as coins with all Decimals places, "1.50000" for 1.5 coins.
+func (a Amount) String() string {
+	var sign string
+	u := uint64(a)
+	if a < 0 {
+		sign = "-"
+		u = uint64(-(a + 1)) + 1 // -MinInt64 doesn't fit in an int64
+	}
+
+	whole := strconv.FormatUint(u/uint64(Unit), 10)
+	frac := strconv.FormatUint(u%uint64(Unit), 10)
+	return sign + whole + "." + strings.Repeat("0", Decimals-len(frac)) + frac
+}
+
+// ParseAmount parses a decimal amount of coins like "12", "0.5" or "1.00001".
+// More than Decimals decimal places is an error, rounding money is not our call.
+func ParseAmount(s string) (Amount, error) {
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+
+	if len(frac) > Decimals || (whole == "" && frac == "") || !digits(whole) || !digits(frac) {
+		return 0, ErrSyntax
+	}
+	frac += strings.Repeat("0", Decimals-len(frac))
+
+	var w, f uint64
+	var err error
+	if whole != "" {
+		if w, err = strconv.ParseUint(whole, 10, 64); err != nil {
+			return 0, ErrOverflow
+		}
+	}
+	if f, err = strconv.ParseUint(frac, 10, 64); err != nil {
+		return 0, ErrSyntax
+	}
+
+	if w > uint64(MaxAmount/Unit) {
+		return 0, ErrOverflow
+	}
+	return (Amount(w) * Unit).Add(Amount(f))
+}
+
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalText implements encoding.TextMarshaler, used by encoding/json too.
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, see ParseAmount.
+func (a *Amount) UnmarshalText(text []byte) error {
+	v, err := ParseAmount(string(text))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
@@ -0,0 +1,100 @@
+package coin
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAmountArithmetic(t *testing.T) {
+	Convey("Add and Sub", t, func() {
+		a, err := Amount(5).Add(7)
+		So(err, ShouldBeNil)
+		So(a, ShouldEqual, 12)
+
+		_, err = MaxAmount.Add(1)
+		So(err, ShouldEqual, ErrOverflow)
+
+		_, err = Amount(5).Sub(6)
+		So(err, ShouldEqual, ErrNegative)
+
+		a, err = Amount(5).Add(-5)
+		So(err, ShouldBeNil)
+		So(a, ShouldEqual, 0)
+	})
+
+	Convey("Mul", t, func() {
+		a, err := Unit.Mul(3)
+		So(err, ShouldBeNil)
+		So(a, ShouldEqual, 3*Unit)
+
+		_, err = MaxAmount.Mul(2)
+		So(err, ShouldEqual, ErrOverflow)
+
+		_, err = Unit.Mul(-1)
+		So(err, ShouldEqual, ErrNegative)
+	})
+
+	Convey("Sum", t, func() {
+		a, err := Sum(1, 2, 3)
+		So(err, ShouldBeNil)
+		So(a, ShouldEqual, 6)
+
+		_, err = Sum(MaxAmount, 1)
+		So(err, ShouldEqual, ErrOverflow)
+	})
+}
+
+type parseTest struct {
+	In  string
+	Out Amount
+	Err error
+}
+
+func TestParseAmount(t *testing.T) {
+	cases := []parseTest{
+		{"0", 0, nil},
+		{"12", 12 * Unit, nil},
+		{"1.5", Unit + Unit/2, nil},
+		{".5", Unit / 2, nil},
+		{"0.00001", 1, nil},
+		{"92233720368547.75807", MaxAmount, nil},
+		{"92233720368547.75808", 0, ErrOverflow},
+		{"99999999999999999999", 0, ErrOverflow},
+		{"0.000001", 0, ErrSyntax},
+		{"", 0, ErrSyntax},
+		{".", 0, ErrSyntax},
+		{"-1", 0, ErrSyntax},
+		{"1,234", 0, ErrSyntax},
+		{"$1", 0, ErrSyntax},
+	}
+
+	for _, test := range cases {
+		Convey("ParseAmount("+test.In+")", t, func() {
+			a, err := ParseAmount(test.In)
+			So(err, ShouldEqual, test.Err)
+			So(a, ShouldEqual, test.Out)
+		})
+	}
+}
+
+func TestAmountText(t *testing.T) {
+	Convey("String keeps every decimal place", t, func() {
+		So(Amount(0).String(), ShouldEqual, "0.00000")
+		So((Unit + 1).String(), ShouldEqual, "1.00001")
+		So(Amount(-Unit/2).String(), ShouldEqual, "-0.50000")
+		So(Amount(-1<<63).String(), ShouldEqual, "-92233720368547.75808")
+	})
+
+	Convey("JSON round trip", t, func() {
+		in := struct{ Amount Amount }{12*Unit + 34}
+		b, err := json.Marshal(in)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"Amount":"12.00034"}`)
+
+		var out struct{ Amount Amount }
+		So(json.Unmarshal(b, &out), ShouldBeNil)
+		So(out.Amount, ShouldEqual, in.Amount)
+	})
+}
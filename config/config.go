@@ -4,72 +4,95 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"time"
+
+	"github.com/toqueteos/altcoin/coin"
 )
 
+// MaxMessageSize is the biggest message peers exchange, blocks included.
+const MaxMessageSize = 65536 // 64kb, instead of 60000
+
+// MaxBlockSize is how big (as in tools.JSONLen) the txs of a block can be,
+// leaving room for the rest of the block in a message.
+const MaxBlockSize = MaxMessageSize - 5000
+
 func Get() *Config  { return currentConfig }
 func Set(c *Config) { currentConfig = c }
 
 var currentConfig = DefaultConfig
 
+// Config is everything a node can be configured with, the rules of the network
+// it's part of come from the embedded ChainParams.
 type Config struct {
-	CoinName     string
-	Version      string
-	DatabaseFile string
+	*ChainParams
+
+	CoinName string
+	Version  string
 
 	CheckPeersEvery time.Duration
-	ListenPort      int
 
 	HashesPerCheck int
-	BlockReward    int
-	Premine        int
-	Fee            int
+	MinFee         coin.Amount // Spends paying less aren't valid.
 
-	Mmm        int     // Lower limits on what the "time" tag in a block can say.
-	Inflection float64 // This constant is selected such that the 50 most recent blocks count for 1/2 the total weight.
+	// Block times must be after the median time of the MedianTimeSpan blocks
+	// before them, and at most MaxFutureDrift ahead of our clock. Our clock
+	// follows the peers' as long as they're at most MaxClockOffset away.
+	MedianTimeSpan int
+	MaxFutureDrift time.Duration
+	MaxClockOffset time.Duration
 
-	DownloadMany int // Max number of blocks to request from a peer at the same time.
-	MaxDownload  int
-	// Take the median of this many blocks.
-	// How far back in history do we look when we use statistics to guess at the
-	// current blocktime and difficulty.
-	HistoryLength int
+	DownloadMany  int // Max number of blocks to request from a peer at the same time.
+	MaxReorgDepth int // Max number of blocks we'll disconnect to switch to a better branch.
+	MaxSideBlocks int // Max number of side branch blocks kept in memory.
+	MaxDownload   int
+
+	MempoolSize   int           // Max bytes of pending txs we keep.
+	MempoolExpiry time.Duration // Pending txs are dropped after this long.
+
+	HeaderCacheSize int // Headers of recent blocks kept in memory per chain.
 
 	// Brainwallet string // "brain wallet"
 	// Privatekey  string // Hash(Brainwallet)
 	// Publickey   *btcec.PublicKey // _, pub := tools.ParseKeyPair(privkey)
 
 	UseSSL             bool
-	GuiPort            int
-	GuiPortSSL         int
 	GuiSessionKeyPairs [][]byte
 }
 
-var DefaultConfig = &Config{
-	CoinName:        "AltCoin",
-	Version:         "VERSION",
-	DatabaseFile:    "",
-	CheckPeersEvery: time.Duration(5 * time.Second),
-	ListenPort:      10022,
-	HashesPerCheck:  100000,
-	BlockReward:     100000,
-	Premine:         5000000,
-	Fee:             1000,
-	Mmm:             100,
-	Inflection:      0.985,
-	DownloadMany:    500,
-	MaxDownload:     50000,
-	HistoryLength:   400,
-	UseSSL:          false,
-	GuiPort:         10080,
-	GuiPortSSL:      10443,
-	GuiSessionKeyPairs: [][]byte{
-		[]byte("type-in-a-random-string-here"),
-		[]byte("type-in-another-random-string-here"),
-	},
+// New returns the default configuration of a node on the network params
+// describes. Each call returns a new Config, params is shared and must not be
+// modified.
+func New(params *ChainParams) *Config {
+	return &Config{
+		ChainParams:     params,
+		CoinName:        "AltCoin",
+		Version:         "VERSION",
+		CheckPeersEvery: time.Duration(5 * time.Second),
+		HashesPerCheck:  100000,
+		MinFee:          1000,
+		MedianTimeSpan:  100,
+		MaxFutureDrift:  2 * time.Hour,
+		MaxClockOffset:  70 * time.Minute,
+		DownloadMany:    500,
+		MaxReorgDepth:   100,
+		MaxSideBlocks:   1000,
+		MaxDownload:     50000,
+		MempoolSize:     4 * MaxMessageSize,
+		MempoolExpiry:   24 * time.Hour,
+		HeaderCacheSize: 1000,
+		UseSSL:          false,
+		GuiSessionKeyPairs: [][]byte{
+			[]byte("type-in-a-random-string-here"),
+			[]byte("type-in-another-random-string-here"),
+		},
+	}
 }
 
+// DefaultConfig is the configuration of a mainnet node.
+var DefaultConfig = New(MainNet)
+
 var Hash = hash
 var BlockTime = blockTime
+var Schedule = schedule
 
 // Hash takes sha256 hash of: (dict, list, int or str) supplied as a string.
 func hash(s string) string {
@@ -80,8 +103,30 @@ func hash(s string) string {
 }
 
 func blockTime(length int) int {
-	if length*Get().BlockReward < Get().Premine {
+	// Overflowing means we are way past the premine.
+	mined, err := Get().BlockReward.Mul(int64(length))
+	if err == nil && mined < Get().PremineTotal() {
 		return 30 // seconds
 	}
 	return 60
 }
+
+// schedule is how many seconds blocks 1 to length should take, the BlockTime
+// of each added up, without going through them one by one.
+func schedule(length int) int64 {
+	if length < 1 {
+		return 0
+	}
+
+	// Blocks up to fast are the ones mined before the premine's worth of
+	// rewards, see blockTime.
+	fast := int64(length)
+	reward, premine := int64(Get().BlockReward), int64(Get().PremineTotal())
+	switch {
+	case premine <= 0:
+		fast = 0
+	case reward > 0 && (premine-1)/reward < fast:
+		fast = (premine - 1) / reward
+	}
+	return 30*fast + 60*(int64(length)-fast)
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/toqueteos/altcoin/coin"
+)
+
+var ErrUnknownNetwork = errors.New("config: unknown network")
+
+// ChainParams are the rules of a network. Nodes only talk to nodes of the
+// same network and keep their own chain of it, separate from other networks'.
+type ChainParams struct {
+	Name string
+
+	// Magic starts every message between peers, peers of other networks
+	// are hung up on.
+	Magic [4]byte
+
+	ListenPort   int
+	GuiPort      int
+	GuiPortSSL   int
+	DatabaseFile string
+	Peers        []string // Who to ask for blocks when starting.
+
+	// AddressPrefix starts every address, spends to an address of another
+	// network are refused so coins can't be sent there by mistake. See
+	// tools.ValidAddress.
+	AddressPrefix string
+
+	// Every node builds the same genesis block out of these, see
+	// blockchain.Genesis. GenesisHash is what it must hash to, so changing
+	// any of them by mistake doesn't go unnoticed.
+	GenesisTime    time.Time
+	GenesisMessage string
+	GenesisNonce   int64
+	GenesisHash    string
+
+	// The reward schedule, see package reward. Blocks pay BlockReward,
+	// halved every HalvingInterval blocks (never if 0), but never less than
+	// TailEmission. RewardSteps, sorted by From, replace BlockReward and
+	// halvings when set. Rewards stop once MaxSupply coins exist, premine
+	// included, unless it's 0.
+	BlockReward     coin.Amount
+	HalvingInterval int
+	TailEmission    coin.Amount
+	MaxSupply       coin.Amount
+	RewardSteps     []RewardStep
+
+	// Mint rewards can't be spent until this many blocks are on top of
+	// theirs, so short reorgs don't take away coins already spent. With 0
+	// they can be spent in their own block.
+	CoinbaseMaturity int
+
+	// Premine is paid by the genesis block, in this order. It's part of
+	// the genesis block so it's covered by GenesisHash too.
+	Premine []Allocation
+
+	// Name of the difficulty algorithm, see package difficulty. The ones
+	// after it only matter to the algorithm they name.
+	Difficulty string
+
+	// Take the median of this many blocks.
+	// How far back in history do we look when we use statistics to guess at the
+	// current blocktime and difficulty.
+	HistoryLength int
+	Inflection    float64 // This constant is selected such that the 50 most recent blocks count for 1/2 the total weight.
+
+	RetargetInterval int           // Blocks between retargets, "epoch".
+	LWMAWindow       int           // Block times averaged, "lwma".
+	ASERTHalfLife    time.Duration // How far behind doubles the target, "asert".
+
+	// MaxBits is the easiest target allowed in compact form, which every
+	// chain starts with.
+	MaxBits uint32
+}
+
+// Allocation is a payment of the genesis block.
+type Allocation struct {
+	Address string
+	Amount  coin.Amount
+}
+
+// RewardStep makes blocks from From on pay Reward, until the next step.
+type RewardStep struct {
+	From   int
+	Reward coin.Amount
+}
+
+// PremineTotal is what Premine adds up to, coin.MaxAmount if it overflows.
+func (p *ChainParams) PremineTotal() coin.Amount {
+	var total coin.Amount
+	for _, a := range p.Premine {
+		var err error
+		if total, err = total.Add(a.Amount); err != nil {
+			return coin.MaxAmount
+		}
+	}
+	return total
+}
+
+// MainNet is the network of real coins. It has no premine, derived coins
+// wanting one must pay it to keys nobody else knows.
+var MainNet = &ChainParams{
+	Name:         "mainnet",
+	Magic:        [4]byte{0xa1, 0x7c, 0x01, 0x4e},
+	ListenPort:   10022,
+	GuiPort:      10080,
+	GuiPortSSL:   10443,
+	DatabaseFile: "altcoin.db",
+	Peers: []string{
+		"localhost:8901",
+		"localhost:8902",
+		"localhost:8903",
+		"localhost:8904",
+		"localhost:8905",
+	},
+	AddressPrefix:    "",
+	GenesisTime:      time.Date(2014, 6, 1, 0, 0, 0, 0, time.UTC),
+	GenesisMessage:   "altcoin mainnet, 1 Jun 2014: the simplest crypto-currency",
+	GenesisNonce:     6878,
+	GenesisHash:      "e493e223fddde7489227857176ce06c87ccd3384d8340bbe988b95e386fe4c22",
+	BlockReward:      1 * coin.Unit,
+	HalvingInterval:  210000,
+	CoinbaseMaturity: 100,
+	Difficulty:       "basiccoin",
+	HistoryLength:    400,
+	Inflection:       0.985,
+	RetargetInterval: 2016,
+	LWMAWindow:       60,
+	ASERTHalfLife:    2 * 24 * time.Hour,
+	MaxBits:          0x1f00ffff,
+}
+
+// TestNet has coins worth nothing and reacts quickly to miners coming and
+// going, which it sees a lot of.
+var TestNet = &ChainParams{
+	Name:         "testnet",
+	Magic:        [4]byte{0xa1, 0x7c, 0x02, 0x74},
+	ListenPort:   20022,
+	GuiPort:      20080,
+	GuiPortSSL:   20443,
+	DatabaseFile: "altcoin-testnet.db",
+	Peers: []string{
+		"localhost:18901",
+		"localhost:18902",
+		"localhost:18903",
+	},
+	AddressPrefix:    "t",
+	GenesisTime:      time.Date(2014, 6, 2, 0, 0, 0, 0, time.UTC),
+	GenesisMessage:   "altcoin testnet, coins worth nothing",
+	GenesisNonce:     264,
+	GenesisHash:      "a655a4865cf10dc2ff103689ec7689c43c041df3241ca9c83c1f45231d86d5b0",
+	BlockReward:      1 * coin.Unit,
+	HalvingInterval:  210000,
+	TailEmission:     coin.Unit / 100,
+	CoinbaseMaturity: 100,
+	Difficulty:       "lwma",
+	HistoryLength:    400,
+	Inflection:       0.985,
+	RetargetInterval: 2016,
+	LWMAWindow:       60,
+	ASERTHalfLife:    2 * 24 * time.Hour,
+	MaxBits:          0x1f00ffff,
+}
+
+// RegTest is for running a private chain in tests: there are no peers to
+// begin with and blocks are mined instantly, the difficulty never changes.
+// Its premine goes to the wallet altcoind uses by default, so there are coins
+// to play with right away.
+var RegTest = &ChainParams{
+	Name:             "regtest",
+	Magic:            [4]byte{0xa1, 0x7c, 0x03, 0x72},
+	ListenPort:       30022,
+	GuiPort:          30080,
+	GuiPortSSL:       30443,
+	DatabaseFile:     "altcoin-regtest.db",
+	AddressPrefix:    "r",
+	GenesisTime:      time.Date(2014, 6, 3, 0, 0, 0, 0, time.UTC),
+	GenesisMessage:   "altcoin regtest",
+	GenesisNonce:     1,
+	GenesisHash:      "38a1935bf10645f2f627c638cbbd3bc0a7633637264c1325c9ad29503cfc4131",
+	BlockReward:      1 * coin.Unit,
+	HalvingInterval:  150,
+	CoinbaseMaturity: 100,
+	Premine: []Allocation{
+		{Address: "r11327777585a344d454357577067735a6a6f3654635031536e64434b5559", Amount: 50 * coin.Unit},
+	},
+	Difficulty: "fixed",
+	MaxBits:    0x207fffff,
+}
+
+var networks = []*ChainParams{MainNet, TestNet, RegTest}
+
+// Network returns the built in network called name.
+func Network(name string) (*ChainParams, error) {
+	for _, params := range networks {
+		if params.Name == name {
+			return params, nil
+		}
+	}
+	return nil, fmt.Errorf("%v %q", ErrUnknownNetwork, name)
+}
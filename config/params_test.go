@@ -0,0 +1,69 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/toqueteos/altcoin/coin"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNetwork(t *testing.T) {
+	Convey("Built in networks are found by name", t, func() {
+		for _, want := range []*ChainParams{MainNet, TestNet, RegTest} {
+			params, err := Network(want.Name)
+			So(err, ShouldBeNil)
+			So(params, ShouldEqual, want)
+		}
+
+		_, err := Network("moonnet")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Networks don't share magic, ports, databases or peers", t, func() {
+		magics := make(map[[4]byte]bool)
+		ports := make(map[int]bool)
+		files := make(map[string]bool)
+		peers := make(map[string]bool)
+		for _, params := range networks {
+			So(magics[params.Magic], ShouldBeFalse)
+			magics[params.Magic] = true
+
+			for _, port := range []int{params.ListenPort, params.GuiPort, params.GuiPortSSL} {
+				So(ports[port], ShouldBeFalse)
+				ports[port] = true
+			}
+
+			So(files[params.DatabaseFile], ShouldBeFalse)
+			files[params.DatabaseFile] = true
+
+			for _, peer := range params.Peers {
+				So(peers[peer], ShouldBeFalse)
+				peers[peer] = true
+			}
+		}
+	})
+
+	Convey("Schedule adds up every BlockTime", t, func() {
+		defer Set(Get())
+		for _, premine := range []coin.Amount{0, 1, 7 * coin.Unit, 7*coin.Unit + 1} {
+			params := *MainNet
+			params.Premine = []Allocation{{Address: "a", Amount: premine}}
+			Set(New(&params))
+
+			var total int64
+			for length := 1; length < 20; length++ {
+				total += int64(BlockTime(length))
+				So(Schedule(length), ShouldEqual, total)
+			}
+		}
+		So(Schedule(0), ShouldEqual, 0)
+	})
+
+	Convey("New doesn't share the config between calls", t, func() {
+		a, b := New(MainNet), New(MainNet)
+		a.Version = "changed"
+		So(b.Version, ShouldNotEqual, "changed")
+		So(a.ChainParams, ShouldEqual, b.ChainParams)
+	})
+}
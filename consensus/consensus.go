@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/toqueteos/altcoin/blockchain"
+	"github.com/toqueteos/altcoin/clock"
 	"github.com/toqueteos/altcoin/config"
 	"github.com/toqueteos/altcoin/server"
 	"github.com/toqueteos/altcoin/tools"
@@ -15,16 +16,23 @@ func Run(db *types.DB, peers []string) {
 	for _ = range time.Tick(config.Get().CheckPeersEvery) {
 		CheckPeers(db, peers)
 
-		// Suggestions
-		for _, tx := range db.SuggestedTxs {
-			blockchain.AddTx(tx, db)
+		// Suggestions, taken under the lock since the miner adds to them.
+		db.Lock()
+		txs, blocks := db.SuggestedTxs, db.SuggestedBlocks
+		db.SuggestedTxs, db.SuggestedBlocks = nil, nil
+		db.Unlock()
+
+		for _, tx := range txs {
+			if err := blockchain.AddTx(tx, db); err != nil {
+				log.Println("[consensus.Run] suggested tx rejected:", err)
+			}
 		}
-		db.SuggestedTxs = nil
 
-		for _, block := range db.SuggestedBlocks {
-			blockchain.AddBlock(block, db)
+		for _, block := range blocks {
+			if err := blockchain.ProcessBlock(block, db); err != nil {
+				log.Printf("[consensus.Run] suggested block %d rejected: %v", block.Length, err)
+			}
 		}
-		db.SuggestedBlocks = nil
 	}
 }
 
@@ -33,26 +41,37 @@ func CheckPeers(db *types.DB, peers []string) {
 	obj := &checkPeers{db, peers}
 
 	for _, peer := range peers {
-		resp, err := server.SendCommand(peer, &server.Request{Type: "blockcount"})
+		sent := time.Now()
+		resp, err := server.SendCommand(peer, &server.Request{Type: "BlockCount"})
 		if err != nil {
 			log.Println("[consensus.CheckPeers] blockcount request failed with error:", err)
 			continue
 		}
 
+		// Peers of our network started from the same genesis, or haven't
+		// started at all yet.
+		if resp.Genesis != "" && resp.Genesis != config.Get().GenesisHash {
+			log.Printf("[consensus.CheckPeers] ignoring %s, its genesis is %s", peer, resp.Genesis)
+			continue
+		}
+
+		// Our idea of the time follows the peers'.
+		if network, ok := db.Clock.(*clock.Network); ok && !resp.Time.IsZero() {
+			network.AddSample(peer, resp.Time, sent, time.Now())
+		}
+
 		// if not isinstance(block_count, dict): return
 		// if "error" in block_count.keys(): return
 
-		length := db.Length
-		size := tools.Max(len(db.DiffLength), len(resp.DiffLength))
-		us := tools.ZerosLeft(db.DiffLength, size)
-		them := tools.ZerosLeft(resp.DiffLength, size)
+		db.RLock()
+		length, diffLength := db.Length, db.DiffLength
+		db.RUnlock()
 
-		if them < us {
+		switch resp.DiffLength.Cmp(diffLength) {
+		case -1:
 			obj.giveBlock(peer, resp.Length)
 			continue
-		}
-
-		if us == them {
+		case 0:
 			obj.askForTxs(peer)
 			continue
 		}
@@ -66,62 +85,70 @@ type checkPeers struct {
 	peers []string
 }
 
-func (obj *checkPeers) forkCheck(newblocks []*types.Block) bool {
-	block := obj.db.GetBlock(obj.db.Length)
-	//their_hashes = map(tools.DetHash, newblocks)
-	recentHash := tools.DetHash(block)
-	var theirHashes []string
-	for _, b := range newblocks {
-		theirHashes = append(theirHashes, tools.DetHash(b))
-	}
-	//return recent_hash not in their_hashes
-	return tools.NotIn(recentHash, theirHashes)
-}
-
-func (obj *checkPeers) bounds(length int, blockCount int) []int {
+// bounds returns the range of blocks to ask for, starting back blocks behind
+// our tip so the peer's blocks connect to something we know.
+func (obj *checkPeers) bounds(length int, blockCount int, back int) []int {
 	var end int
 	if blockCount-length > config.Get().DownloadMany {
 		end = length + config.Get().DownloadMany - 1
 	} else {
 		end = blockCount
 	}
-	return []int{tools.Max(length-2, 0), end}
+	return []int{tools.Max(length-back, 0), end}
 }
 
+// downloadBlocks gets the blocks we are missing from peer. When they don't
+// connect to our chain we keep looking further back, which finds forks up to
+// MaxReorgDepth blocks deep, and let blockchain.ProcessBlock reorganize.
 func (obj *checkPeers) downloadBlocks(peer string, blockCount int, length int) {
-	resp, err := server.SendCommand(peer, &server.Request{Type: "range", Range: obj.bounds(length, blockCount)})
-	if err != nil || resp.Blocks == nil {
-		log.Println("[consensus.downloadBlocks] range request failed with error:", err)
-		return
-	}
+	for back := 2; ; back *= 2 {
+		resp, err := server.SendCommand(peer, &server.Request{Type: "RangeRequest", Range: obj.bounds(length, blockCount, back)})
+		if err != nil || resp.Blocks == nil {
+			log.Println("[consensus.downloadBlocks] range request failed with error:", err)
+			return
+		}
 
-	// Only delete a max of 2 blocks, otherwise a peer might trick us into deleting everything over and over.
-	for i := 0; i < 2; i++ {
-		if obj.forkCheck(resp.Blocks) {
-			blockchain.DeleteBlock(obj.db)
+		err = obj.processBlocks(resp.Blocks)
+		if err != blockchain.ErrOrphan || back > length || back > config.Get().MaxReorgDepth {
+			if err != nil {
+				log.Println("[consensus.downloadBlocks] peer's blocks rejected:", err)
+			}
+			return
 		}
 	}
+}
 
-	// DB['suggested_blocks'].extend(blocks)
-	obj.db.SuggestedBlocks = append(obj.db.SuggestedBlocks, resp.Blocks...)
+func (obj *checkPeers) processBlocks(blocks []*types.Block) error {
+	for _, block := range blocks {
+		if block == nil {
+			continue
+		}
+		err := blockchain.ProcessBlock(block, obj.db)
+		if err != nil && err != blockchain.ErrBlockKnown {
+			return err
+		}
+	}
+	return nil
 }
 
 func (obj *checkPeers) askForTxs(peer string) {
-	resp, err := server.SendCommand(peer, &server.Request{Type: "txs"})
+	resp, err := server.SendCommand(peer, &server.Request{Type: "Txs"})
 	if err != nil {
 		log.Println("[consensus.askForTxs] txs request failed with error:", err)
 		return
 	}
 
 	// DB['suggested_txs'].extend(txs)
+	obj.db.Lock()
 	obj.db.SuggestedTxs = append(obj.db.SuggestedTxs, resp.Txs...)
+	obj.db.Unlock()
 
 	// pushers = [x for x in DB['txs'] if x not in txs]
 	// for push in pushers: cmd({'type': 'pushtx', 'tx': push})
 	var pushers = make(map[*types.Tx]bool)
-	for _, push := range obj.db.Txs {
+	for _, push := range obj.db.Pool.Txs() {
 		if _, ok := pushers[push]; !ok {
-			if _, err := server.SendCommand(peer, &server.Request{Type: "pushtx", Tx: push}); err != nil {
+			if _, err := server.SendCommand(peer, &server.Request{Type: "PushTx", Tx: push}); err != nil {
 				log.Println("[consensus.askForTxs] pushtx request failed with error:", err)
 			}
 			pushers[push] = true
@@ -130,7 +157,11 @@ func (obj *checkPeers) askForTxs(peer string) {
 }
 
 func (obj *checkPeers) giveBlock(peer string, blockCount int) {
-	_, err := server.SendCommand(peer, &server.Request{Type: "pushblock", Block: obj.db.GetBlock(blockCount + 1)})
+	obj.db.RLock()
+	block := obj.db.GetBlock(blockCount + 1)
+	obj.db.RUnlock()
+
+	_, err := server.SendCommand(peer, &server.Request{Type: "PushBlock", Block: block})
 	if err != nil {
 		log.Println("[consensus.giveBlock] pushblock request failed with error:", err)
 		return
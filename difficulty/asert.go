@@ -0,0 +1,68 @@
+package difficulty
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/types"
+)
+
+func init() {
+	Register("asert", func(c *config.Config) DifficultyAlgorithm {
+		return &ASERT{HalfLife: c.ASERTHalfLife}
+	})
+}
+
+// ASERT is Bitcoin Cash's absolutely scheduled exponentially rising targets
+// (aserti3-2d) anchored at genesis: the target doubles for every HalfLife the
+// chain is behind schedule and halves for every HalfLife it is ahead. Only
+// genesis and the last block matter, so it can't be gamed by the order of
+// timestamps in between.
+type ASERT struct {
+	HalfLife time.Duration
+}
+
+func (a *ASERT) Target(chain Chain, length int) *types.Target {
+	halfLife := seconds(a.HalfLife)
+	if length < 2 || halfLife < 1 {
+		return MaxTarget()
+	}
+
+	anchor := chain.GetHeader(0)
+	prev := chain.GetHeader(length - 1)
+
+	behind := prev.Time.Unix() - anchor.Time.Unix() - config.Schedule(length-1)
+
+	// 2^(behind/halfLife) as a 16 bit fixed point number: the whole part
+	// is a shift and the fractional one comes from a cubic approximation,
+	// exactly as in aserti3-2d.
+	exponent := behind * 65536 / halfLife
+	shifts := exponent >> 16
+	frac := big.NewInt(exponent & 0xffff)
+
+	poly := new(big.Int).Mul(big.NewInt(195766423245049), frac)
+	frac2 := new(big.Int).Mul(frac, frac)
+	poly.Add(poly, new(big.Int).Mul(big.NewInt(971821376), frac2))
+	poly.Add(poly, new(big.Int).Mul(big.NewInt(5127), frac2.Mul(frac2, frac)))
+	poly.Add(poly, new(big.Int).Lsh(big.NewInt(1), 47))
+	factor := poly.Rsh(poly, 48)
+	factor.Add(factor, big.NewInt(65536))
+
+	// Past these the target is 1 or MaxTarget anyway.
+	switch {
+	case shifts > 256:
+		return MaxTarget()
+	case shifts < -256:
+		return result(big.NewInt(1))
+	}
+
+	next := target(anchor)
+	next.Mul(next, factor)
+	if shifts < 0 {
+		next.Rsh(next, uint(-shifts))
+	} else {
+		next.Lsh(next, uint(shifts))
+	}
+	return result(next.Rsh(next, 16))
+}
@@ -0,0 +1,94 @@
+package difficulty
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/types"
+)
+
+func init() {
+	Register("basiccoin", func(c *config.Config) DifficultyAlgorithm {
+		return &Basiccoin{HistoryLength: c.HistoryLength, Inflection: c.Inflection}
+	})
+}
+
+// Basiccoin is the retarget inherited from basiccoin: geometrically weighted
+// averages of the last HistoryLength targets and block times, where each block
+// weighs Inflection times the one after it.
+//
+// Weights are 32 bit fixed point numbers, basiccoin truncated them to whole
+// numbers which made every one of them zero.
+type Basiccoin struct {
+	HistoryLength int
+	Inflection    float64
+}
+
+// The first blocks have too little history to average.
+const basiccoinWarmup = 4
+
+// inverter is what targets are inverted against, as basiccoin did.
+var inverter = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 512), big.NewInt(1))
+
+func (b *Basiccoin) Target(chain Chain, length int) *types.Target {
+	if length < basiccoinWarmup {
+		return MaxTarget()
+	}
+
+	start := length - b.HistoryLength
+	if start < 0 {
+		start = 0
+	}
+	var (
+		targets []*big.Int
+		times   []int64
+	)
+	for i := start; i < length; i++ {
+		h := chain.GetHeader(i)
+		targets = append(targets, target(h))
+		times = append(times, h.Time.UnixNano())
+	}
+
+	// We are actually interested in the average number of hashes required
+	// to mine a block. Number of hashes required is inversely proportional
+	// to target. So we average over inverse-targets, and inverse the final
+	// answer.
+	w, tw := b.weights(len(targets))
+	sum := new(big.Int)
+	for i, t := range targets {
+		inv := new(big.Int).Div(inverter, t)
+		sum.Add(sum, inv.Mul(inv, w[i]))
+	}
+	estimate := new(big.Int).Mul(inverter, tw)
+	estimate.Div(estimate, sum)
+
+	// Same weighting over the time between blocks.
+	w, tw = b.weights(len(times) - 1)
+	elapsed := new(big.Int)
+	for i := 1; i < len(times); i++ {
+		dt := big.NewInt(times[i] - times[i-1])
+		elapsed.Add(elapsed, dt.Mul(dt, w[i-1]))
+	}
+	expected := new(big.Int).Mul(tw, big.NewInt(blockTime(length)*1e9))
+
+	return result(adjust(estimate, elapsed, expected))
+}
+
+// weights returns n weights, oldest first, and their sum. The newest block
+// weighs Inflection, the one before Inflection² and so on.
+func (b *Basiccoin) weights(n int) ([]*big.Int, *big.Int) {
+	const one = 1 << 32
+	inflection := big.NewInt(int64(math.Floor(b.Inflection * one)))
+
+	w := make([]*big.Int, n)
+	tw := new(big.Int)
+	next := big.NewInt(one)
+	for i := n - 1; i >= 0; i-- {
+		next = new(big.Int).Mul(next, inflection)
+		next.Rsh(next, 32)
+		w[i] = next
+		tw.Add(tw, next)
+	}
+	return w, tw
+}
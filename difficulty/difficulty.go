@@ -0,0 +1,125 @@
+// Package difficulty decides how hard each block must be to mine.
+//
+// Every algorithm turns the headers of the blocks before a new one into the
+// target the new one must meet, the coin picks one by name in
+// config.Config.Difficulty. Algorithms only do integer arithmetic so every node
+// gets exactly the same target out of the same chain.
+package difficulty
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/types"
+)
+
+// MaxTarget is the easiest target the network allows, config.Get().MaxBits,
+// every chain starts with it.
+func MaxTarget() *types.Target {
+	t, err := types.TargetFromCompact(config.Get().MaxBits)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// MaxAdjust bounds how much a single retarget can change the target, either
+// way, so a few lying timestamps can't swing it wildly.
+const MaxAdjust = 4
+
+var ErrUnknown = errors.New("difficulty: unknown algorithm")
+
+// Chain gives algorithms the headers of the main chain, *types.DB is one.
+type Chain interface {
+	// GetHeader returns the header of the block at length, nil if missing.
+	GetHeader(length int) *types.BlockHeader
+}
+
+type DifficultyAlgorithm interface {
+	// Target returns the target of the block at length, which survives
+	// being put in compact form unchanged. Every block before it is in
+	// chain.
+	Target(chain Chain, length int) *types.Target
+}
+
+var algorithms = map[string]func(*config.Config) DifficultyAlgorithm{}
+
+// Register makes an algorithm available by name, newAlg builds it out of the
+// coin's config. It panics if name is taken.
+func Register(name string, newAlg func(*config.Config) DifficultyAlgorithm) {
+	if _, dup := algorithms[name]; dup {
+		panic("difficulty: Register called twice for " + name)
+	}
+	algorithms[name] = newAlg
+}
+
+// New returns the algorithm c.Difficulty names.
+func New(c *config.Config) (DifficultyAlgorithm, error) {
+	newAlg, ok := algorithms[c.Difficulty]
+	if !ok {
+		return nil, fmt.Errorf("%v %q", ErrUnknown, c.Difficulty)
+	}
+	return newAlg(c), nil
+}
+
+// Names returns the registered algorithms, sorted.
+func Names() []string {
+	var names []string
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// target returns the target of h as a big.Int, blocks in the chain were
+// already checked to have a valid one.
+func target(h *types.BlockHeader) *big.Int {
+	t, err := h.Target()
+	if err != nil {
+		return MaxTarget().Int()
+	}
+	return t.Int()
+}
+
+// result clamps n between 1 and MaxTarget and drops the precision the compact
+// form can't keep.
+func result(n *big.Int) *types.Target {
+	t := types.NewTarget(n)
+	switch {
+	case n.Sign() <= 0:
+		t = types.NewTarget(big.NewInt(1))
+	case t.Cmp(MaxTarget()) > 0:
+		t = MaxTarget()
+	}
+	t, _ = types.TargetFromCompact(t.Compact())
+	return t
+}
+
+// adjust returns target * num / den with num/den kept within MaxAdjust, or
+// target itself if den is zero.
+func adjust(target *big.Int, num, den *big.Int) *big.Int {
+	if den.Sign() == 0 {
+		return target
+	}
+	max := new(big.Int).Mul(den, big.NewInt(MaxAdjust))
+	min := new(big.Int).Div(den, big.NewInt(MaxAdjust))
+	switch {
+	case num.Cmp(max) > 0:
+		num = max
+	case num.Cmp(min) < 0:
+		num = min
+	}
+
+	n := new(big.Int).Mul(target, num)
+	return n.Div(n, den)
+}
+
+// blockTime is how long the block at length should take, in seconds.
+func blockTime(length int) int64 { return int64(config.BlockTime(length)) }
+
+func seconds(d time.Duration) int64 { return int64(d / time.Second) }
@@ -0,0 +1,141 @@
+package difficulty
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/types"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testChain []*types.BlockHeader
+
+func (c testChain) GetHeader(length int) *types.BlockHeader { return c[length] }
+
+const testBits = 0x1d00ffff
+
+var (
+	testTarget, _ = types.TargetFromCompact(testBits)
+	genesis       = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// newChain returns length blocks with testTarget, each taking scale times its
+// block time plus jitter(i) seconds.
+func newChain(length int, scale int64, jitter func(i int) int64) testChain {
+	chain := testChain{{Time: genesis, Bits: testBits}}
+	for i := 1; i < length; i++ {
+		d := scale*blockTime(i) + jitter(i)
+		chain = append(chain, &types.BlockHeader{
+			Time: chain[i-1].Time.Add(time.Duration(d) * time.Second),
+			Bits: testBits,
+		})
+	}
+	return chain
+}
+
+func none(int) int64 { return 0 }
+
+// times returns testTarget multiplied by num/den.
+func times(num, den int64) string {
+	n := testTarget.Int()
+	n.Mul(n, big.NewInt(num))
+	return result(n.Div(n, big.NewInt(den))).String()
+}
+
+// testConfig returns a copy of the default config with a copy of its params,
+// so tests can change them.
+func testConfig() *config.Config {
+	params := *config.MainNet
+	return config.New(&params)
+}
+
+// testAlgorithms returns the algorithms that retarget.
+func testAlgorithms() map[string]DifficultyAlgorithm {
+	c := testConfig()
+	c.HistoryLength = 50
+	c.RetargetInterval = 20
+	c.LWMAWindow = 30
+	c.ASERTHalfLife = time.Hour
+
+	algs := make(map[string]DifficultyAlgorithm)
+	for _, name := range []string{"asert", "basiccoin", "epoch", "lwma"} {
+		c.Difficulty = name
+		alg, err := New(c)
+		if err != nil {
+			panic(err)
+		}
+		algs[name] = alg
+	}
+	return algs
+}
+
+func TestRegistry(t *testing.T) {
+	Convey("Algorithms are picked by name", t, func() {
+		So(Names(), ShouldResemble, []string{"asert", "basiccoin", "epoch", "fixed", "lwma"})
+
+		c := testConfig()
+		c.Difficulty = "nope"
+		_, err := New(c)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Fixed always says MaxTarget", t, func() {
+		So(Fixed{}.Target(newChain(100, 10, none), 100).String(), ShouldEqual, MaxTarget().String())
+	})
+}
+
+func TestTargets(t *testing.T) {
+	algs := testAlgorithms()
+
+	Convey("Every chain starts at MaxTarget", t, func() {
+		for _, alg := range algs {
+			So(alg.Target(testChain{}, 0).String(), ShouldEqual, MaxTarget().String())
+		}
+	})
+
+	Convey("Blocks on schedule keep the target", t, func() {
+		chain := newChain(100, 1, none)
+		for _, alg := range algs {
+			So(alg.Target(chain, 100).String(), ShouldEqual, testTarget.String())
+		}
+	})
+
+	Convey("Blocks twice as slow double the target", t, func() {
+		chain := newChain(100, 2, none)
+		So(algs["basiccoin"].Target(chain, 100).String(), ShouldEqual, times(2, 1))
+		So(algs["lwma"].Target(chain, 100).String(), ShouldEqual, times(2, 1))
+		So(algs["epoch"].Target(chain, 100).String(), ShouldEqual, times(2, 1))
+		So(algs["epoch"].Target(chain, 99).String(), ShouldEqual, testTarget.String())
+	})
+
+	Convey("ASERT doubles the target every half life behind schedule", t, func() {
+		chain := newChain(100, 1, none)
+		chain[99].Time = chain[99].Time.Add(time.Hour)
+		So(algs["asert"].Target(chain, 100).String(), ShouldEqual, times(2, 1))
+		chain[99].Time = chain[99].Time.Add(-2 * time.Hour)
+		So(algs["asert"].Target(chain, 100).String(), ShouldEqual, times(1, 2))
+	})
+
+	Convey("A single retarget can't change the target more than MaxAdjust", t, func() {
+		chain := newChain(100, 10, none)
+		So(algs["basiccoin"].Target(chain, 100).String(), ShouldEqual, times(MaxAdjust, 1))
+		So(algs["lwma"].Target(chain, 100).String(), ShouldEqual, times(MaxAdjust, 1))
+		So(algs["epoch"].Target(chain, 100).String(), ShouldEqual, times(MaxAdjust, 1))
+	})
+
+	Convey("Irregular block times", t, func() {
+		chain := newChain(100, 1, func(i int) int64 { return int64(i*37%101) - 50 })
+		vectors := map[string]uint32{
+			"asert":     0x1d0101c7,
+			"basiccoin": 0x1d0100b1,
+			"epoch":     0x1d00fc95,
+			"lwma":      0x1d01032b,
+		}
+		for name, bits := range vectors {
+			So(algs[name].Target(chain, 100).Compact(), ShouldEqual, bits)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package difficulty
+
+import (
+	"math/big"
+
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/types"
+)
+
+func init() {
+	Register("epoch", func(c *config.Config) DifficultyAlgorithm {
+		return &Epoch{Interval: c.RetargetInterval}
+	})
+}
+
+// Epoch is Bitcoin's retarget: the target stays the same for Interval blocks,
+// then scales by how long those took against how long they should have.
+//
+// Unlike Bitcoin the time of the whole epoch is measured, Bitcoin misses the
+// time between the last block of an epoch and the first of the next one.
+type Epoch struct {
+	Interval int
+}
+
+func (e *Epoch) Target(chain Chain, length int) *types.Target {
+	if length == 0 || e.Interval < 1 {
+		return MaxTarget()
+	}
+
+	prev := chain.GetHeader(length - 1)
+	if length%e.Interval != 0 {
+		return result(target(prev))
+	}
+
+	// The first epoch has no block before it, it's measured from genesis.
+	first := length - e.Interval - 1
+	if first < 0 {
+		first = 0
+	}
+	blocks := int64(length - 1 - first)
+	if blocks == 0 {
+		return result(target(prev))
+	}
+
+	elapsed := prev.Time.Unix() - chain.GetHeader(first).Time.Unix()
+	expected := blocks * blockTime(length)
+	return result(adjust(target(prev), big.NewInt(elapsed), big.NewInt(expected)))
+}
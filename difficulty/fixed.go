@@ -0,0 +1,18 @@
+package difficulty
+
+import (
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/types"
+)
+
+func init() {
+	Register("fixed", func(c *config.Config) DifficultyAlgorithm {
+		return Fixed{}
+	})
+}
+
+// Fixed never retargets, every block has MaxTarget. It's only good for chains
+// nobody else mines, like regtest's.
+type Fixed struct{}
+
+func (Fixed) Target(chain Chain, length int) *types.Target { return MaxTarget() }
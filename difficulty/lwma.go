@@ -0,0 +1,60 @@
+package difficulty
+
+import (
+	"math/big"
+
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/types"
+)
+
+func init() {
+	Register("lwma", func(c *config.Config) DifficultyAlgorithm {
+		return &LWMA{Window: c.LWMAWindow}
+	})
+}
+
+// LWMA is a linearly weighted moving average of the last Window block times,
+// the newest counting Window times as much as the oldest. It reacts to
+// hashrate changes within a few blocks.
+type LWMA struct {
+	Window int
+}
+
+// Solve times are clamped to this many block times, so one block with a time
+// far in the future can't make the next ones trivial.
+const lwmaMaxSolveTime = 6
+
+func (l *LWMA) Target(chain Chain, length int) *types.Target {
+	n := l.Window
+	if n > length-1 {
+		n = length - 1
+	}
+	if n < 1 {
+		return MaxTarget()
+	}
+
+	T := blockTime(length)
+	var (
+		sumTargets = new(big.Int)
+		weighted   int64 // Sum of i * solve time of the ith block.
+		prev       = chain.GetHeader(length - n - 1).Time.Unix()
+	)
+	for i := 1; i <= n; i++ {
+		h := chain.GetHeader(length - n - 1 + i)
+		solveTime := h.Time.Unix() - prev
+		switch {
+		case solveTime < 1:
+			solveTime = 1
+		case solveTime > lwmaMaxSolveTime*T:
+			solveTime = lwmaMaxSolveTime * T
+		}
+		prev = h.Time.Unix()
+
+		weighted += int64(i) * solveTime
+		sumTargets.Add(sumTargets, target(h))
+	}
+
+	average := sumTargets.Div(sumTargets, big.NewInt(int64(n)))
+	expected := int64(n*(n+1)/2) * T
+	return result(adjust(average, big.NewInt(weighted), big.NewInt(expected)))
+}
@@ -1,7 +1,9 @@
 package gui
 
 import (
+	"github.com/toqueteos/altcoin/coin"
 	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/types"
 )
 
 var defaultCtx = Context{config.Get().CoinName}
@@ -15,6 +17,11 @@ type signErrorCtx struct {
 	Err error
 }
 
+type accountErrorCtx struct {
+	Context
+	Err error
+}
+
 type amountErrorCtx struct {
 	Context
 	Amount string
@@ -24,6 +31,30 @@ type spendCtx struct {
 	Context
 	PrivKey      string
 	Address      string
+	PubKey       string // Hex, for others to make multisig addresses with.
 	CurrentBlock int
-	Balance      float64
+	Balance      coin.Amount
+	Immature     coin.Amount // Not part of Balance, see types.Account.Maturing.
+	MinFee       coin.Amount
+	Pending      []pendingTx
+	History      []*types.HistoryEntry
+	// History paging, newer is only used when Page > 0.
+	Page      int
+	NewerPage int
+	OlderPage int
+}
+
+// pendingTx is one of our txs waiting to be mined, which can still be
+// replaced paying at least NextFee.
+type pendingTx struct {
+	Count   int
+	To      string
+	Amount  coin.Amount
+	Fee     coin.Amount
+	NextFee coin.Amount
+}
+
+func newPendingTx(tx *types.Tx) pendingTx {
+	next, _ := tx.Fee.Add(config.Get().MinFee)
+	return pendingTx{tx.Count, tx.To, tx.Amount, tx.Fee, next}
 }
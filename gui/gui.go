@@ -4,14 +4,18 @@
 package gui
 
 import (
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/toqueteos/altcoin/blockchain"
+	"github.com/toqueteos/altcoin/coin"
 	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/mempool"
 	"github.com/toqueteos/altcoin/tools"
+	"github.com/toqueteos/altcoin/transaction"
 	"github.com/toqueteos/altcoin/types"
 
 	"github.com/conformal/btcec"
@@ -21,6 +25,9 @@ import (
 	"github.com/martini-contrib/sessions"
 )
 
+// HistoryPageSize is how many payments the spend page lists at once.
+const HistoryPageSize = 20
+
 func GetHome(ren render.Render) {
 	ren.HTML(200, "wallet", defaultCtx)
 }
@@ -42,7 +49,7 @@ func RequireWallet(params martini.Params, ren render.Render) {
 	ren.HTML(200, "error", defaultCtx)
 }
 
-func GetSpend(db *types.DB, params martini.Params, ren render.Render) {
+func GetSpend(db *types.DB, params martini.Params, req *http.Request, ren render.Render) {
 	privkey := params["privkey"]
 	// Get our own public key
 	_, pubkey := tools.ParseKeyPair(privkey)
@@ -51,22 +58,66 @@ func GetSpend(db *types.DB, params martini.Params, ren render.Render) {
 	addr := tools.MakeAddress([]*btcec.PublicKey{pubkey}, 1)
 	// TODO: Some sort of balance cache would be nice
 	// (instead of traversing the entire blockchain).
-	balance := db.GetAccount(addr).Amount
-	for _, tx := range db.Txs {
+	db.RLock()
+	defer db.RUnlock()
+	acc, err := db.GetAccount(addr)
+	if err != nil {
+		ren.HTML(200, "errors/account", accountErrorCtx{defaultCtx, err})
+		return
+	}
+	// Balance is what can be spent right now, rewards still maturing are
+	// shown on their own.
+	immature, err := acc.Immature(db.Length + 1)
+	if err != nil {
+		ren.HTML(200, "errors/account", accountErrorCtx{defaultCtx, err})
+		return
+	}
+	balance, err := acc.Spendable(db.Length + 1)
+	if err != nil {
+		ren.HTML(200, "errors/account", accountErrorCtx{defaultCtx, err})
+		return
+	}
+	var pending []pendingTx
+	for _, tx := range db.Pool.Txs() {
+		// Pending txs that would overflow or overdraw are simply not counted.
 		if tx.Type == "spend" && tx.To == addr {
-			balance += tx.Amount - config.Get().Fee
+			if b, err := balance.Add(tx.Amount); err == nil {
+				balance = b
+			}
 		}
-		if tx.Type == "spend" && tx.PubKeys[0] == pubkey {
-			balance -= tx.Amount
+		if tx.Type == "spend" && tools.MakeAddress(tx.PubKeys, len(tx.Signatures)) == addr {
+			pending = append(pending, newPendingTx(tx))
+			if cost, err := tx.Amount.Add(tx.Fee); err == nil {
+				if b, err := balance.Sub(cost); err == nil {
+					balance = b
+				}
+			}
 		}
 	}
 
+	page, _ := strconv.Atoi(req.FormValue("page"))
+	if page < 0 {
+		page = 0
+	}
+	history, err := db.GetHistory(addr, page*HistoryPageSize, HistoryPageSize)
+	if err != nil {
+		log.Println("GetHistory error:", err)
+	}
+
 	ren.HTML(200, "spend", spendCtx{
 		Context:      defaultCtx,
 		PrivKey:      privkey,
 		Address:      addr,
+		PubKey:       hex.EncodeToString(pubkey.SerializeCompressed()),
 		CurrentBlock: db.Length,
-		Balance:      float64(balance) / 100000.0,
+		Balance:      balance,
+		Immature:     immature,
+		MinFee:       config.Get().MinFee,
+		Pending:      pending,
+		History:      history,
+		Page:         page,
+		NewerPage:    page - 1,
+		OlderPage:    page + 1,
 	})
 }
 
@@ -75,16 +126,49 @@ func PostSpend(db *types.DB, params martini.Params, req *http.Request, ren rende
 	privkey := params["privkey"]
 	// Form input
 	formAmount := req.FormValue("amount")
+	formFee := req.FormValue("fee")
 	formTo := req.FormValue("to")
 
-	amount, err := strconv.Atoi(formAmount)
+	amount, err := coin.ParseAmount(formAmount)
 	if err != nil {
 		ren.HTML(200, "errors/amount", amountErrorCtx{defaultCtx, formAmount})
 		return
 	}
+	fee, err := coin.ParseAmount(formFee)
+	if err != nil {
+		ren.HTML(200, "errors/amount", amountErrorCtx{defaultCtx, formFee})
+		return
+	}
 
-	if err := spend(db, amount, privkey, formTo); err != nil {
+	if err := spend(db, amount, fee, privkey, formTo); err != nil {
 		ren.HTML(200, "errors/sign", signErrorCtx{defaultCtx, err})
+		return
+	}
+
+	ren.Redirect("/spend/"+privkey, http.StatusOK)
+}
+
+// /spend/:privkey/replace
+func PostReplace(db *types.DB, params martini.Params, req *http.Request, ren render.Render) {
+	privkey := params["privkey"]
+	// Form input
+	formFee := req.FormValue("fee")
+	cancel := req.FormValue("action") == "cancel"
+
+	count, err := strconv.Atoi(req.FormValue("count"))
+	if err != nil {
+		ren.HTML(200, "errors/sign", signErrorCtx{defaultCtx, err})
+		return
+	}
+	fee, err := coin.ParseAmount(formFee)
+	if err != nil {
+		ren.HTML(200, "errors/amount", amountErrorCtx{defaultCtx, formFee})
+		return
+	}
+
+	if err := replace(db, fee, privkey, count, cancel); err != nil {
+		ren.HTML(200, "errors/sign", signErrorCtx{defaultCtx, err})
+		return
 	}
 
 	ren.Redirect("/spend/"+privkey, http.StatusOK)
@@ -115,6 +199,7 @@ func Run(db *types.DB) {
 
 	r.Get("/spend/:privkey", RequireWallet, GetSpend)
 	r.Post("/spend/:privkey", RequireWallet, PostSpend)
+	r.Post("/spend/:privkey/replace", RequireWallet, PostReplace)
 
 	if !config.Get().UseSSL {
 		// HTTP
@@ -136,9 +221,7 @@ func Run(db *types.DB) {
 // spend adds a tx which represents `from` paying `amount` coins to `to`.
 // Both `from` and `to` are the string version of PrivateKey and PublicKey
 // of the sender and receiver, respectively.
-func spend(db *types.DB, amount int, from string, to string) error {
-	amount = amount * 100000 // or: amount *= 100000
-
+func spend(db *types.DB, amount, fee coin.Amount, from string, to string) error {
 	privkey, pubkey := tools.ParseKeyPair(from)
 	pubkeys := []*btcec.PublicKey{pubkey}
 	addr := tools.MakeAddress(pubkeys, 1)
@@ -147,6 +230,7 @@ func spend(db *types.DB, amount int, from string, to string) error {
 		Type:    "spend",
 		PubKeys: pubkeys,
 		Amount:  amount,
+		Fee:     fee,
 		To:      to,
 	}
 
@@ -155,16 +239,52 @@ func spend(db *types.DB, amount int, from string, to string) error {
 	// except:
 	//     tx["count"] = 1
 	// Why try .. except?
-	tx.Count = blockchain.Count(addr, db)
-
-	htx := []byte(tools.DetHash(tx))
-	sign, err := privkey.Sign(htx)
+	count, err := blockchain.Count(addr, db)
 	if err != nil {
 		return err
 	}
+	tx.Count = count
+
+	return signAndAdd(db, tx, privkey)
+}
+
+// replace bumps the fee of our pending tx with the given count or, with
+// cancel, pays ourselves instead so only the fee is spent.
+func replace(db *types.DB, fee coin.Amount, from string, count int, cancel bool) error {
+	privkey, pubkey := tools.ParseKeyPair(from)
+	pubkeys := []*btcec.PublicKey{pubkey}
+	addr := tools.MakeAddress(pubkeys, 1)
+
+	old := db.Pool.Pending(addr, count)
+	if old == nil {
+		return mempool.ErrNotPending
+	}
+
+	tx := &types.Tx{
+		Type:    "spend",
+		PubKeys: pubkeys,
+		Amount:  old.Amount,
+		Fee:     fee,
+		To:      old.To,
+		Count:   count,
+	}
+	if cancel {
+		// Smallest amount there is, it comes right back anyway.
+		tx.Amount = 1
+		tx.To = addr
+	}
+
+	return signAndAdd(db, tx, privkey)
+}
+
+// signAndAdd signs tx the way SpendVerify checks it, see transaction.Sign.
+// Signing DetHash(tx) directly, as we used to, never verified.
+func signAndAdd(db *types.DB, tx *types.Tx, privkey *btcec.PrivateKey) error {
+	tx.Signatures = []*btcec.Signature{nil}
+	if err := transaction.Sign(tx, privkey); err != nil {
+		return err
+	}
 
-	tx.Signatures = []*btcec.Signature{sign}
 	log.Println("Created Tx:", tx)
-	blockchain.AddTx(tx, db)
-	return nil
+	return blockchain.AddTx(tx, db)
 }
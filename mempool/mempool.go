@@ -0,0 +1,427 @@
+// Package mempool keeps the txs waiting to be mined.
+//
+// The pool doesn't verify txs, blockchain.AddTx does that before calling Add.
+// It only keeps them indexed by hash and ordered by Count per sender, limits
+// how much memory they use and decides which ones go into the next block.
+package mempool
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/toqueteos/altcoin/coin"
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/tools"
+	"github.com/toqueteos/altcoin/types"
+)
+
+var (
+	ErrDuplicate = errors.New("mempool: tx already in the pool")
+	ErrFull      = errors.New("mempool: pool is full and tx pays too little")
+	ErrTooBig    = errors.New("mempool: tx is bigger than the pool")
+)
+
+// Reasons for Replace to refuse a replacement.
+var (
+	ErrNotPending          = errors.New("mempool: no pending tx to replace")
+	ErrReplaceFee          = errors.New("mempool: replacement must pay at least MinFee more")
+	ErrReplaceRate         = errors.New("mempool: replacement pays less per byte")
+	ErrTooManyReplacements = errors.New("mempool: tx was replaced too many times")
+	ErrTooManyDescendants  = errors.New("mempool: too many later txs depend on the replaced one")
+)
+
+// Limits on replacements, so nobody can make us verify the same txs over and
+// over for the price of a single fee bump.
+const (
+	MaxReplacements = 10 // Per sender and Count.
+	MaxDescendants  = 25 // Later txs of the sender put back after a replacement.
+)
+
+type entry struct {
+	tx    *types.Tx
+	hash  string
+	addr  string
+	size  int
+	fee   coin.Amount
+	added time.Time
+}
+
+// paysMore reports whether a pays more per byte than b, without dividing.
+func (a *entry) paysMore(b *entry) bool {
+	return float64(a.fee)*float64(b.size) > float64(b.fee)*float64(a.size)
+}
+
+// Pool is safe for concurrent use.
+type Pool struct {
+	mu sync.Mutex
+
+	maxSize int
+	expiry  time.Duration
+	now     func() time.Time
+
+	size   int
+	byHash map[string]*entry
+	byAddr map[string][]*entry // sorted by Count
+
+	// When txs taken out by Reset were first seen, so putting them back
+	// doesn't make them any younger.
+	seen map[string]time.Time
+
+	// How many times each sender and Count was replaced, see slot.
+	replacements map[string]int
+}
+
+// New returns a pool holding up to maxSize bytes (as in tools.JSONLen) of txs,
+// each for no longer than expiry.
+func New(maxSize int, expiry time.Duration) *Pool {
+	return &Pool{
+		maxSize: maxSize,
+		expiry:  expiry,
+		now:     time.Now,
+		byHash:  make(map[string]*entry),
+		byAddr:  make(map[string][]*entry),
+
+		replacements: make(map[string]int),
+	}
+}
+
+func slot(addr string, count int) string { return addr + "/" + strconv.Itoa(count) }
+
+// fee is what a tx pays to get mined.
+func fee(tx *types.Tx) coin.Amount {
+	if tx.Type == "spend" {
+		return tx.Fee
+	}
+	return 0
+}
+
+// Add puts tx in the pool. If the pool is full the txs paying the least per
+// byte are evicted to make room, unless tx is the one paying the least.
+func (p *Pool) Add(tx *types.Tx) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.add(p.newEntry(tx))
+}
+
+func (p *Pool) newEntry(tx *types.Tx) *entry {
+	return &entry{
+		tx:    tx,
+		hash:  tools.DetHash(tx),
+		addr:  tools.MakeAddress(tx.PubKeys, len(tx.Signatures)),
+		size:  tools.JSONLen(tx) + 1, // And the comma separating it from the next tx.
+		fee:   fee(tx),
+		added: p.now(),
+	}
+}
+
+func (p *Pool) add(e *entry) error {
+	if _, ok := p.byHash[e.hash]; ok {
+		return ErrDuplicate
+	}
+	if e.size > p.maxSize {
+		return ErrTooBig
+	}
+	if added, ok := p.seen[e.hash]; ok {
+		e.added = added
+		delete(p.seen, e.hash)
+	}
+
+	p.expire()
+	evicted, err := p.evictions(e)
+	if err != nil {
+		return err
+	}
+	for _, worst := range evicted {
+		p.remove(worst)
+	}
+
+	p.insert(e)
+	return nil
+}
+
+// evictions returns the txs to remove, in order, to make room for e. Nothing
+// is removed yet, so a tx that doesn't get in costs nobody their place.
+func (p *Pool) evictions(e *entry) ([]*entry, error) {
+	left := make(map[string]int, len(p.byAddr))
+	for addr, queue := range p.byAddr {
+		left[addr] = len(queue)
+	}
+
+	var evicted []*entry
+	size := p.size
+	for size+e.size > p.maxSize {
+		worst := p.worstTail(left)
+		if worst == nil || !e.paysMore(worst) {
+			return nil, ErrFull
+		}
+		evicted = append(evicted, worst)
+		left[worst.addr]--
+		size -= worst.size
+	}
+	return evicted, nil
+}
+
+// insert puts e in the pool without checking it fits.
+func (p *Pool) insert(e *entry) {
+	p.byHash[e.hash] = e
+	queue := append(p.byAddr[e.addr], e)
+	sort.Sort(byCount(queue))
+	p.byAddr[e.addr] = queue
+	p.size += e.size
+}
+
+// worstTail is the last tx of some sender paying the least per byte, only
+// those can go without breaking the Count sequence of their sender. Senders
+// only have their first left[addr] txs.
+func (p *Pool) worstTail(left map[string]int) *entry {
+	var worst *entry
+	for addr, n := range left {
+		if n == 0 {
+			continue
+		}
+		tail := p.byAddr[addr][n-1]
+		if worst == nil || worst.paysMore(tail) {
+			worst = tail
+		}
+	}
+	return worst
+}
+
+// remove drops e and every later tx of its sender, they can't be mined
+// without it.
+func (p *Pool) remove(e *entry) {
+	queue := p.byAddr[e.addr]
+	for i, other := range queue {
+		if other != e {
+			continue
+		}
+		for _, dropped := range queue[i:] {
+			delete(p.byHash, dropped.hash)
+			p.size -= dropped.size
+		}
+		if i == 0 {
+			delete(p.byAddr, e.addr)
+		} else {
+			p.byAddr[e.addr] = queue[:i]
+		}
+		return
+	}
+}
+
+// expire drops every tx older than the pool's expiry.
+func (p *Pool) expire() {
+	if p.expiry <= 0 {
+		return
+	}
+	deadline := p.now().Add(-p.expiry)
+	for _, queue := range p.byAddr {
+		for _, e := range queue {
+			if e.added.Before(deadline) {
+				p.remove(e)
+				break
+			}
+		}
+	}
+}
+
+// Pending returns the waiting tx from addr with the given Count, nil if there
+// is none.
+func (p *Pool) Pending(addr string, count int) *types.Tx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e := p.pending(addr, count); e != nil {
+		return e.tx
+	}
+	return nil
+}
+
+func (p *Pool) pending(addr string, count int) *entry {
+	for _, e := range p.byAddr[addr] {
+		if e.tx.Count == count {
+			return e
+		}
+	}
+	return nil
+}
+
+// Replace swaps the pending tx with the same sender and Count as tx for tx,
+// which is how fees are bumped and txs cancelled (by paying oneself). tx must
+// pay at least MinFee more than the old one and no less per byte.
+//
+// The sender's later txs are taken out too and returned, the caller must
+// verify them again since tx may spend differently, and Add them back.
+func (p *Pool) Replace(tx *types.Tx) ([]*types.Tx, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e := p.newEntry(tx)
+	old := p.pending(e.addr, tx.Count)
+	if old == nil {
+		return nil, ErrNotPending
+	}
+	if _, ok := p.byHash[e.hash]; ok {
+		return nil, ErrDuplicate
+	}
+
+	bump, err := old.fee.Add(config.Get().MinFee)
+	if err != nil || e.fee < bump {
+		return nil, ErrReplaceFee
+	}
+	if old.paysMore(e) {
+		return nil, ErrReplaceRate
+	}
+	if p.replacements[slot(e.addr, tx.Count)] >= MaxReplacements {
+		return nil, ErrTooManyReplacements
+	}
+
+	var later []*types.Tx
+	var dropped []*entry // old and later, what remove takes out.
+	for _, other := range p.byAddr[e.addr] {
+		if other.tx.Count >= tx.Count {
+			dropped = append(dropped, other)
+		}
+		if other.tx.Count > tx.Count {
+			later = append(later, other.tx)
+		}
+	}
+	if len(later) > MaxDescendants {
+		return nil, ErrTooManyDescendants
+	}
+	if e.size > p.maxSize {
+		return nil, ErrTooBig
+	}
+
+	// Replacing keeps the place in line of the original.
+	e.added = old.added
+	p.remove(old)
+	if err := p.add(e); err != nil {
+		// The sender keeps their txs if tx can't get in, they fit before
+		// and add evicted nobody.
+		for _, d := range dropped {
+			p.insert(d)
+		}
+		return nil, err
+	}
+	p.replacements[slot(e.addr, tx.Count)]++
+	return later, nil
+}
+
+// Remove drops the tx with the given hash and every later tx of its sender.
+func (p *Pool) Remove(hash string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.byHash[hash]; ok {
+		p.remove(e)
+	}
+}
+
+// Get returns the tx with the given hash, nil if it isn't in the pool.
+func (p *Pool) Get(hash string) *types.Tx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.byHash[hash]; ok {
+		return e.tx
+	}
+	return nil
+}
+
+// Count is how many txs from addr are waiting.
+func (p *Pool) Count(addr string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire()
+	return len(p.byAddr[addr])
+}
+
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire()
+	return len(p.byHash)
+}
+
+// Txs returns every tx in the pool in the order they'd be mined.
+func (p *Pool) Txs() []*types.Tx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire()
+	return p.selectTxs(p.size)
+}
+
+// Select returns the txs that should go into the next block, best paying
+// first, without going over maxSize bytes. A sender's txs are always taken in
+// Count order.
+func (p *Pool) Select(maxSize int) []*types.Tx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire()
+	return p.selectTxs(maxSize)
+}
+
+func (p *Pool) selectTxs(maxSize int) []*types.Tx {
+	next := make(map[string]int, len(p.byAddr))
+
+	var txs []*types.Tx
+	size := 0
+	for {
+		// Best paying of the first txs not taken yet of every sender.
+		var best *entry
+		for addr, queue := range p.byAddr {
+			i := next[addr]
+			if i == len(queue) || size+queue[i].size > maxSize {
+				continue
+			}
+			if e := queue[i]; best == nil || e.paysMore(best) || (!best.paysMore(e) && e.added.Before(best.added)) {
+				best = e
+			}
+		}
+		if best == nil {
+			return txs
+		}
+
+		txs = append(txs, best.tx)
+		size += best.size
+		next[best.addr]++
+	}
+}
+
+// Reset empties the pool and returns what it held in mining order, so the
+// caller can verify them again and Add back the ones still valid.
+func (p *Pool) Reset() []*types.Tx {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire()
+	txs := p.selectTxs(p.size)
+
+	p.seen = make(map[string]time.Time, len(p.byHash))
+	replacements := make(map[string]int)
+	for hash, e := range p.byHash {
+		p.seen[hash] = e.added
+		if n := p.replacements[slot(e.addr, e.tx.Count)]; n > 0 {
+			replacements[slot(e.addr, e.tx.Count)] = n
+		}
+	}
+	p.replacements = replacements
+	p.size = 0
+	p.byHash = make(map[string]*entry)
+	p.byAddr = make(map[string][]*entry)
+	return txs
+}
+
+type byCount []*entry
+
+func (s byCount) Len() int           { return len(s) }
+func (s byCount) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byCount) Less(i, j int) bool { return s[i].tx.Count < s[j].tx.Count }
@@ -0,0 +1,153 @@
+package mempool
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/tools"
+	"github.com/toqueteos/altcoin/types"
+
+	"github.com/conformal/btcec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testTx(seed, count int, kind string) *types.Tx {
+	_, pub := tools.ParseKeyPair(tools.DetHashInt(seed))
+	tx := &types.Tx{
+		Type:       kind,
+		Count:      count,
+		Amount:     5000,
+		PubKeys:    []*btcec.PublicKey{pub},
+		Signatures: []*btcec.Signature{nil},
+		To:         "someone",
+	}
+	if kind == "spend" {
+		tx.Fee = 1000
+	}
+	return tx
+}
+
+func TestPool(t *testing.T) {
+	Convey("Txs of a sender come out in Count order", t, func() {
+		p := New(1<<20, 0)
+		So(p.Add(testTx(1, 1, "spend")), ShouldBeNil)
+		So(p.Add(testTx(1, 0, "spend")), ShouldBeNil)
+		So(p.Add(testTx(1, 0, "spend")), ShouldEqual, ErrDuplicate)
+
+		txs := p.Txs()
+		So(len(txs), ShouldEqual, 2)
+		So(txs[0].Count, ShouldEqual, 0)
+		So(txs[1].Count, ShouldEqual, 1)
+		So(p.Count(tools.MakeAddress(txs[0].PubKeys, 1)), ShouldEqual, 2)
+
+		// Dropping a tx drops the ones that depend on it.
+		p.Remove(tools.DetHash(txs[0]))
+		So(p.Len(), ShouldEqual, 0)
+	})
+
+	Convey("Better paying txs are mined first", t, func() {
+		p := New(1<<20, 0)
+		cheap, generous := testTx(1, 0, "spend"), testTx(2, 0, "spend")
+		generous.Fee = 5000
+		So(p.Add(cheap), ShouldBeNil)
+		So(p.Add(generous), ShouldBeNil)
+		So(p.Select(1<<20), ShouldResemble, []*types.Tx{generous, cheap})
+	})
+
+	Convey("Full pools evict the worst paying txs", t, func() {
+		size := tools.JSONLen(testTx(1, 0, "spend")) + 1
+		p := New(2*size, 0)
+		free := testTx(1, 0, "free")
+		So(p.Add(free), ShouldBeNil)
+		So(p.Add(testTx(2, 0, "spend")), ShouldBeNil)
+
+		So(p.Add(testTx(3, 0, "spend")), ShouldBeNil)
+		So(p.Get(tools.DetHash(free)), ShouldBeNil)
+		So(p.Add(testTx(4, 0, "free")), ShouldEqual, ErrFull)
+
+		So(len(p.Select(size)), ShouldEqual, 1)
+	})
+
+	Convey("Pending txs can be replaced paying more", t, func() {
+		p := New(1<<20, 0)
+		first, later := testTx(1, 0, "spend"), testTx(1, 1, "spend")
+		So(p.Add(first), ShouldBeNil)
+		So(p.Add(later), ShouldBeNil)
+
+		bump := testTx(1, 0, "spend")
+		bump.Fee = first.Fee + config.Get().MinFee - 1
+		_, err := p.Replace(bump)
+		So(err, ShouldEqual, ErrReplaceFee)
+
+		bump.Fee++
+		out, err := p.Replace(bump)
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, []*types.Tx{later})
+		So(p.Get(tools.DetHash(first)), ShouldBeNil)
+		So(p.Pending(tools.MakeAddress(bump.PubKeys, 1), 0), ShouldEqual, bump)
+
+		_, err = p.Replace(testTx(2, 0, "spend"))
+		So(err, ShouldEqual, ErrNotPending)
+
+		for i := 1; i < MaxReplacements; i++ {
+			next := testTx(1, 0, "spend")
+			next.Fee = bump.Fee + config.Get().MinFee
+			_, err = p.Replace(next)
+			So(err, ShouldBeNil)
+			bump = next
+		}
+		next := testTx(1, 0, "spend")
+		next.Fee = bump.Fee + config.Get().MinFee
+		_, err = p.Replace(next)
+		So(err, ShouldEqual, ErrTooManyReplacements)
+	})
+
+	Convey("Failed replacements leave everyone's txs alone", t, func() {
+		size := tools.JSONLen(testTx(1, 0, "spend")) + 1
+		p := New(5*size, 0)
+		first, later := testTx(1, 0, "spend"), testTx(1, 1, "spend")
+		rich, cheap := testTx(2, 0, "spend"), testTx(3, 0, "spend")
+		rich.Fee = 1000000
+		cheap.Fee = 500
+		So(p.Add(first), ShouldBeNil)
+		So(p.Add(later), ShouldBeNil)
+		So(p.Add(rich), ShouldBeNil)
+		So(p.Add(cheap), ShouldBeNil)
+		So(p.Len(), ShouldEqual, 4)
+
+		// Five times as big, it doesn't fit once the sender's txs are out.
+		// It pays enough to evict cheap but not rich, so neither goes.
+		bump := testTx(1, 0, "spend")
+		bump.Fee = 50000
+		bump.To = strings.Repeat("x", 5*size)
+		_, err := p.Replace(bump)
+		So(err, ShouldEqual, ErrTooBig)
+
+		bump.To = strings.Repeat("x", 4*size)
+		_, err = p.Replace(bump)
+		So(err, ShouldEqual, ErrFull)
+		So(p.Len(), ShouldEqual, 4)
+		So(p.Pending(tools.MakeAddress(first.PubKeys, 1), 0), ShouldEqual, first)
+		So(p.Pending(tools.MakeAddress(first.PubKeys, 1), 1), ShouldEqual, later)
+		So(p.Pending(tools.MakeAddress(cheap.PubKeys, 1), 0), ShouldEqual, cheap)
+		So(p.Select(1<<20), ShouldResemble, []*types.Tx{rich, first, later, cheap})
+	})
+
+	Convey("Old txs expire, even across a Reset", t, func() {
+		now := time.Unix(1000, 0)
+		p := New(1<<20, time.Minute)
+		p.now = func() time.Time { return now }
+
+		So(p.Add(testTx(1, 0, "spend")), ShouldBeNil)
+		now = now.Add(30 * time.Second)
+		for _, tx := range p.Reset() {
+			So(p.Add(tx), ShouldBeNil)
+		}
+		So(p.Len(), ShouldEqual, 1)
+
+		now = now.Add(31 * time.Second)
+		So(p.Len(), ShouldEqual, 0)
+	})
+}
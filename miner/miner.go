@@ -59,7 +59,7 @@ func Miner(worker *Worker) {
 			}
 		}
 
-		solutionFound, err := PoW(block, hashesPerCheck, worker.Restart)
+		solutionFound, err := PoW(&block.BlockHeader, hashesPerCheck, worker.Restart)
 
 		switch {
 		// We hit the hash ceiling.
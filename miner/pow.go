@@ -9,21 +9,25 @@ import (
 	"github.com/toqueteos/altcoin/types"
 )
 
-// Proof-of-Work
-func PoW(block *types.Block, hashes int, restart chan bool) (bool, error) {
-	hh := tools.DetHash(block)
-	block.Nonce = randomNonce("100000000000000000")
+// Proof-of-Work, only the header is hashed: txs are covered by its MerkleRoot.
+func PoW(header *types.BlockHeader, hashes int, restart chan bool) (bool, error) {
+	target, err := header.Target()
+	if err != nil {
+		return false, err
+	}
+	hh := tools.DetHash(header.WithoutNonce())
+	header.Nonce = randomNonce("100000000000000000")
 
 	// count = 0
 	var count int
-	for tools.DetHash(&types.HalfWay{Nonce: block.Nonce, HalfHash: hh}) > block.Target {
+	for !target.CheckHash(tools.DetHash(&types.HalfWay{Nonce: header.Nonce, HalfHash: hh})) {
 		select {
 		case <-restart:
 			// return {"solution_found": true}
 			return true, nil
 		default:
 			count++
-			plus1(block.Nonce) // block.Nonce++
+			plus1(header.Nonce) // header.Nonce++
 
 			if count > hashes {
 				// return {"error": false}
@@ -7,8 +7,11 @@ import (
 	"time"
 
 	"github.com/toqueteos/altcoin/blockchain"
+	"github.com/toqueteos/altcoin/coin"
 	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/reward"
 	"github.com/toqueteos/altcoin/tools"
+	"github.com/toqueteos/altcoin/transaction"
 	"github.com/toqueteos/altcoin/types"
 
 	"github.com/conformal/btcec"
@@ -17,6 +20,7 @@ import (
 var logger = log.New(os.Stdout, "[miner] ", log.Ldate|log.Ltime|log.Lshortfile)
 
 // Run spawns worker processes (multi-CPU mining) and coordinates the effort.
+// The chain must have its genesis block already, see blockchain.InitChain.
 func Run(db *types.DB, peers []string, rewardAddr *btcec.PublicKey) {
 	obj := &runner{
 		db:         db,
@@ -32,19 +36,14 @@ func Run(db *types.DB, peers []string, rewardAddr *btcec.PublicKey) {
 		logger.Printf("Spawning worker %d...", i)
 	}
 
-	var (
-		block  *types.Block
-		length int
-	)
-
 	for {
-		length = db.Length
-		if length == -1 {
-			block = obj.genesis()
-		} else {
-			prevBlock := db.GetBlock(length)
-			block = obj.makeBlock(prevBlock, db.Txs)
-		}
+		db.RLock()
+		length := db.Length
+		prevBlock := db.GetBlock(length)
+		db.RUnlock()
+
+		// Anything that changed since is caught when the block is added.
+		block := obj.makeBlock(prevBlock, obj.selectTxs(length+1))
 
 		work := Work{
 			block:          block,
@@ -60,7 +59,9 @@ func Run(db *types.DB, peers []string, rewardAddr *btcec.PublicKey) {
 			continue
 		}
 
+		db.Lock()
 		db.SuggestedBlocks = append(db.SuggestedBlocks, solvedBlock)
+		db.Unlock()
 
 		// Restart workers
 		logger.Println("Possible solution found, restarting mining workers.")
@@ -78,44 +79,74 @@ type runner struct {
 	workers    []*Worker
 }
 
-func (obj *runner) makeMint() *types.Tx {
+// makeMint pays the reward of the block at length and the fees of txs to
+// rewardAddr.
+func (obj *runner) makeMint(length int, txs []*types.Tx) *types.Tx {
 	pubkeys := []*btcec.PublicKey{obj.rewardAddr}
 	addr := tools.MakeAddress(pubkeys, 1)
 
+	amount, err := transaction.MintAmount(length, txs)
+	if err != nil {
+		logger.Println("Couldn't add up fees:", err)
+		amount = reward.Block(config.Get().ChainParams, length)
+	}
+
+	// A wrong count only gets the block refused.
+	count, err := blockchain.Count(addr, obj.db)
+	if err != nil {
+		logger.Println("Couldn't read our account:", err)
+	}
+
 	return &types.Tx{
 		Type:       "mint",
+		Amount:     amount,
 		PubKeys:    pubkeys,
 		Signatures: []*btcec.Signature{nil},
-		Count:      blockchain.Count(addr, obj.db),
+		Count:      count,
+		Height:     length,
 	}
 }
 
-func (obj *runner) genesis() *types.Block {
-	target := blockchain.Target(obj.db, 0)
-	block := &types.Block{
-		Version:    config.Get().Version,
-		Length:     0,
-		Time:       time.Now(),
-		Target:     target,
-		DiffLength: blockchain.HexInv(target),
-		Txs:        []*types.Tx{obj.makeMint()},
+// selectTxs picks the best paying pool txs that fit in the block at length
+// next to the mint. Sizes add up as in tools.JSONLen: one comma per tx plus the
+// brackets, and the mint is measured with the biggest amount it could ever
+// have.
+func (obj *runner) selectTxs(length int) []*types.Tx {
+	mint := obj.makeMint(length, nil)
+	mint.Amount = coin.MaxAmount
+	return obj.db.Pool.Select(config.MaxBlockSize - tools.JSONLen(mint) - 2)
+}
+
+// blockTime is now, unless the clock is behind the median time past of the
+// chain and the block would be refused.
+func (obj *runner) blockTime(length int) time.Time {
+	obj.db.RLock()
+	earliest := blockchain.MedianTimePast(obj.db, length)
+	obj.db.RUnlock()
+
+	now := obj.db.Clock.Now()
+	if !now.After(earliest) {
+		return earliest.Add(time.Second)
 	}
-	logger.Println("Genesis Block:", block)
-	return block
+	return now
 }
 
 func (obj *runner) makeBlock(prevBlock *types.Block, txs []*types.Tx) *types.Block {
 	length := prevBlock.Length + 1
 	target := blockchain.Target(obj.db, length)
-	diffLength := blockchain.HexSum(prevBlock.DiffLength, blockchain.HexInv(target))
+	diffLength := prevBlock.DiffLength.Add(target.Work())
+	txs = append(txs, obj.makeMint(length, txs))
 	out := &types.Block{
-		Version:    config.Get().Version,
-		Txs:        append(txs, obj.makeMint()),
-		Length:     length,
-		Time:       time.Now(),
-		DiffLength: diffLength,
-		Target:     target,
-		PrevHash:   tools.DetHash(prevBlock),
+		BlockHeader: types.BlockHeader{
+			Version:    config.Get().Version,
+			PrevHash:   tools.DetHash(prevBlock),
+			MerkleRoot: types.MerkleRoot(txs),
+			Time:       obj.blockTime(length),
+			Bits:       target.Compact(),
+			DiffLength: diffLength,
+		},
+		Txs:    txs,
+		Length: length,
 	}
 	return out
 }
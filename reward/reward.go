@@ -0,0 +1,120 @@
+// Package reward decides how many new coins each block pays its miner, as set
+// by the reward schedule of config.ChainParams, and how many coins exist at
+// any height.
+//
+// The schedule is a step function, the reward only changes at halvings or
+// RewardSteps, so supply is added up a step at a time instead of a block at a
+// time.
+package reward
+
+import (
+	"github.com/toqueteos/altcoin/coin"
+	"github.com/toqueteos/altcoin/config"
+)
+
+// Block is the reward of the block at length, fees aren't included.
+// Genesis pays the premine instead and has none.
+func Block(p *config.ChainParams, length int) coin.Amount {
+	if length < 1 {
+		return 0
+	}
+	// Supply never goes down, see Supply.
+	r, _ := Supply(p, length).Sub(Supply(p, length-1))
+	return r
+}
+
+// Supply is how many coins exist once the block at length is connected: the
+// premine plus every block reward so far, fees only move coins around. It
+// stops at MaxSupply, if there's one, and at coin.MaxAmount.
+func Supply(p *config.ChainParams, length int) coin.Amount {
+	if length < 0 {
+		return 0
+	}
+
+	premine := p.PremineTotal()
+	total := premine
+	for _, s := range steps(p) {
+		if s.from > length {
+			break
+		}
+		from, to := s.from, length
+		if from < 1 {
+			from = 1
+		}
+		if s.to >= 0 && s.to < to {
+			to = s.to
+		}
+		if to < from {
+			continue
+		}
+
+		paid, err := s.reward.Mul(int64(to - from + 1))
+		if err == nil {
+			total, err = total.Add(paid)
+		}
+		if err != nil {
+			total = coin.MaxAmount
+			break
+		}
+	}
+
+	// Rewards stop at MaxSupply, the premine alone can go past it.
+	if p.MaxSupply > 0 && total > p.MaxSupply {
+		total = p.MaxSupply
+		if premine > total {
+			total = premine
+		}
+	}
+	return total
+}
+
+// step is a run of blocks, from to to, paying the same reward each.
+// The last one has no end and a to of -1.
+type step struct {
+	from, to int
+	reward   coin.Amount
+}
+
+// steps turns p's schedule into steps, none of them paying less than
+// TailEmission.
+func steps(p *config.ChainParams) []step {
+	tail := func(r coin.Amount) coin.Amount {
+		if r < p.TailEmission {
+			return p.TailEmission
+		}
+		return r
+	}
+
+	var out []step
+	switch {
+	case len(p.RewardSteps) > 0:
+		// Blocks before the first step only get the tail emission.
+		if first := p.RewardSteps[0].From; first > 0 {
+			out = append(out, step{0, first - 1, tail(0)})
+		}
+		for i, rs := range p.RewardSteps {
+			to := -1
+			if i+1 < len(p.RewardSteps) {
+				to = p.RewardSteps[i+1].From - 1
+			}
+			out = append(out, step{rs.From, to, tail(rs.Reward)})
+		}
+
+	case p.HalvingInterval > 0:
+		// Halve until the tail emission takes over, or the reward is gone
+		// which takes 63 halvings at most.
+		for era := uint(0); ; era++ {
+			from := int(era) * p.HalvingInterval
+			r := p.BlockReward >> era
+			if r <= p.TailEmission {
+				out = append(out, step{from, -1, tail(r)})
+				break
+			}
+			out = append(out, step{from, from + p.HalvingInterval - 1, r})
+		}
+
+	default:
+		out = append(out, step{0, -1, tail(p.BlockReward)})
+	}
+	return out
+}
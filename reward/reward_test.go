@@ -0,0 +1,87 @@
+package reward
+
+import (
+	"testing"
+
+	"github.com/toqueteos/altcoin/coin"
+	"github.com/toqueteos/altcoin/config"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func blocks(p *config.ChainParams, lengths ...int) []coin.Amount {
+	var out []coin.Amount
+	for _, length := range lengths {
+		out = append(out, Block(p, length))
+	}
+	return out
+}
+
+func TestBlock(t *testing.T) {
+	Convey("Rewards halve every HalvingInterval blocks", t, func() {
+		p := &config.ChainParams{BlockReward: 100, HalvingInterval: 10}
+		So(blocks(p, 0, 1, 9, 10, 19, 20, 30, 60, 70, 1000), ShouldResemble, []coin.Amount{0, 100, 100, 50, 50, 25, 12, 1, 0, 0})
+	})
+
+	Convey("Rewards don't go below TailEmission", t, func() {
+		p := &config.ChainParams{BlockReward: 100, HalvingInterval: 10, TailEmission: 10}
+		So(blocks(p, 1, 20, 30, 40, 1000000), ShouldResemble, []coin.Amount{100, 25, 12, 10, 10})
+	})
+
+	Convey("RewardSteps replace the halvings", t, func() {
+		p := &config.ChainParams{
+			BlockReward:     100,
+			HalvingInterval: 10,
+			RewardSteps:     []config.RewardStep{{From: 3, Reward: 5}, {From: 5, Reward: 7}, {From: 7, Reward: 0}},
+		}
+		So(blocks(p, 1, 2, 3, 4, 5, 6, 7, 100), ShouldResemble, []coin.Amount{0, 0, 5, 5, 7, 7, 0, 0})
+
+		p.TailEmission = 1
+		So(blocks(p, 1, 3, 7), ShouldResemble, []coin.Amount{1, 5, 1})
+	})
+
+	Convey("Rewards stop at MaxSupply", t, func() {
+		p := &config.ChainParams{
+			BlockReward: 100,
+			MaxSupply:   300,
+			Premine:     []config.Allocation{{Address: "a", Amount: 50}},
+		}
+		So(blocks(p, 1, 2, 3, 4), ShouldResemble, []coin.Amount{100, 100, 50, 0})
+
+		p.Premine[0].Amount = 400
+		So(Block(p, 1), ShouldEqual, 0)
+	})
+}
+
+func TestSupply(t *testing.T) {
+	Convey("Supply is the premine plus every reward so far", t, func() {
+		p := &config.ChainParams{
+			BlockReward:     100,
+			HalvingInterval: 10,
+			TailEmission:    3,
+			MaxSupply:       2000,
+			Premine:         []config.Allocation{{Address: "a", Amount: 50}, {Address: "b", Amount: 25}},
+		}
+		So(Supply(p, -1), ShouldEqual, 0)
+		So(Supply(p, 0), ShouldEqual, 75)
+
+		total := p.PremineTotal()
+		for length := 1; length < 200; length++ {
+			total += Block(p, length)
+			So(Supply(p, length), ShouldEqual, total)
+		}
+		So(total, ShouldEqual, p.MaxSupply)
+	})
+
+	Convey("Without a cap halvings bound supply anyway", t, func() {
+		p := &config.ChainParams{BlockReward: 100, HalvingInterval: 10}
+		So(Supply(p, 1000), ShouldEqual, 9*100+10*(50+25+12+6+3+1))
+		So(Supply(p, 1000000), ShouldEqual, Supply(p, 1000))
+	})
+
+	Convey("Supply can't overflow", t, func() {
+		p := &config.ChainParams{BlockReward: coin.MaxAmount}
+		So(Supply(p, 3), ShouldEqual, coin.MaxAmount)
+		So(Block(p, 3), ShouldEqual, 0)
+	})
+}
@@ -1,6 +1,9 @@
 package server
 
 import (
+	"time"
+
+	"github.com/toqueteos/altcoin/blockchain"
 	"github.com/toqueteos/altcoin/config"
 	"github.com/toqueteos/altcoin/tools"
 	"github.com/toqueteos/altcoin/types"
@@ -16,6 +19,11 @@ type Request struct {
 	*types.Tx `json:"tx,omitempty"`
 	// PushBlock
 	*types.Block `json:"block,omitempty"`
+	// MerkleProof
+	Height int `json:"height,omitempty"`
+	Index  int `json:"index,omitempty"`
+	// GetTx
+	TxHash string `json:"txhash,omitempty"`
 }
 
 type Response struct {
@@ -23,15 +31,25 @@ type Response struct {
 	Secure bool   `json:"secure,omitempty"`
 	Error  string `json:"error,omitempty"`
 	// BlockCount
-	Length     int    `json:"length,omitempty"`
-	RecentHash int    `json:"recentHash,omitempty"`
-	DiffLength string `json:"diffLength,omitempty"`
+	Length     int         `json:"length,omitempty"`
+	RecentHash int         `json:"recentHash,omitempty"`
+	DiffLength *types.Work `json:"diffLength,omitempty"`
+	Time       time.Time   `json:"time,omitempty"` // Peer's clock, see clock.Network.
+	Genesis    string      `json:"genesis,omitempty"`
 	// RangeRequest
 	Blocks []*types.Block `json:"blocks,omitempty"`
 	// Txs
 	Txs []*types.Tx `json:"txs,omitempty"`
 	// PushTx, PushBlock
 	Status string `json:"status,omitempty"`
+	// MerkleProof
+	Header *types.BlockHeader `json:"header,omitempty"`
+	TxHash string             `json:"txhash,omitempty"`
+	Proof  []types.MerkleStep `json:"proof,omitempty"`
+	// GetTx (also uses TxHash)
+	Tx            *types.Tx         `json:"tx,omitempty"`
+	Location      *types.TxLocation `json:"location,omitempty"`
+	Confirmations int               `json:"confirmations,omitempty"`
 }
 
 // Extra ifs for improved "security", right now it just checks version.
@@ -43,10 +61,13 @@ func SecurityCheck(req *Request) *Response {
 }
 
 func BlockCount(req *Request, db *types.DB) *Response {
+	db.RLock()
+	defer db.RUnlock()
+
 	if db.Length >= 0 {
-		return &Response{Length: db.Length, RecentHash: db.RecentHash, DiffLength: db.DiffLength}
+		return &Response{Length: db.Length, RecentHash: db.RecentHash, DiffLength: db.DiffLength, Time: time.Now(), Genesis: tools.DetHash(db.GetBlock(0))}
 	}
-	return &Response{Length: -1, RecentHash: 0, DiffLength: "0"}
+	return &Response{Length: -1, RecentHash: 0, DiffLength: types.NewWork(0), Time: time.Now()}
 }
 
 func RangeRequest(req *Request, db *types.DB) *Response {
@@ -55,6 +76,9 @@ func RangeRequest(req *Request, db *types.DB) *Response {
 		counter int
 	)
 
+	db.RLock()
+	defer db.RUnlock()
+
 	for tools.JSONLen(resp) < config.Get().MaxDownload && req.Range[0]+counter <= req.Range[1] {
 		block := db.GetBlock(req.Range[0] + counter)
 		// if "length" in block: out.append(block)
@@ -67,16 +91,70 @@ func RangeRequest(req *Request, db *types.DB) *Response {
 
 func Txs(req *Request, db *types.DB) *Response {
 	var resp Response
-	resp.Txs = db.Txs
+	resp.Txs = db.Pool.Txs()
 	return &resp
 }
 
+// PushTx adds the tx right away so peers learn why it was rejected.
 func PushTx(req *Request, db *types.DB) *Response {
-	db.SuggestedTxs = append(db.SuggestedTxs, req.Tx)
+	if req.Tx == nil {
+		return &Response{Error: "missing tx"}
+	}
+	if err := blockchain.AddTx(req.Tx, db); err != nil {
+		logger.Println("PushTx rejected:", err)
+		return &Response{Error: err.Error()}
+	}
 	return &Response{Status: "success"}
 }
 
+// PushBlock adds the block right away so peers learn why it was rejected.
 func PushBlock(req *Request, db *types.DB) *Response {
-	db.SuggestedBlocks = append(db.SuggestedBlocks, req.Block)
+	if req.Block == nil {
+		return &Response{Error: "missing block"}
+	}
+	if err := blockchain.ProcessBlock(req.Block, db); err != nil {
+		logger.Println("PushBlock rejected:", err)
+		return &Response{Error: err.Error()}
+	}
 	return &Response{Status: "success"}
 }
+
+// MerkleProof lets light clients check a tx is in a block they only have the header of.
+func MerkleProof(req *Request, db *types.DB) *Response {
+	db.RLock()
+	defer db.RUnlock()
+
+	block := db.GetBlock(req.Height)
+	if block == nil {
+		return &Response{Error: "unknown block"}
+	}
+
+	proof, err := block.MerkleProof(req.Index)
+	if err != nil {
+		return &Response{Error: err.Error()}
+	}
+
+	return &Response{
+		Header: &block.BlockHeader,
+		TxHash: types.TxHash(block.Txs[req.Index]),
+		Proof:  proof,
+	}
+}
+
+// GetTx looks up a mined tx by hash, confirmations counts its own block.
+func GetTx(req *Request, db *types.DB) *Response {
+	db.RLock()
+	defer db.RUnlock()
+
+	tx, loc := db.GetTx(req.TxHash)
+	if tx == nil {
+		return &Response{Error: "unknown tx"}
+	}
+
+	return &Response{
+		TxHash:        req.TxHash,
+		Tx:            tx,
+		Location:      loc,
+		Confirmations: db.Length - loc.Height + 1,
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
@@ -14,10 +15,11 @@ import (
 	"github.com/toqueteos/altcoin/types"
 )
 
-const MaxMessageSize = 65536 // 64kb, instead of 60000
+const MaxMessageSize = config.MaxMessageSize
 
 var (
-	ErrSize = errors.New("Wrong sized message")
+	ErrSize  = errors.New("Wrong sized message")
+	ErrMagic = errors.New("Peer is on another network")
 
 	logger = log.New(os.Stdout, "[server] ", log.Ldate|log.Ltime|log.Lshortfile)
 
@@ -27,6 +29,8 @@ var (
 		"Txs":          Txs,
 		"PushTx":       PushTx,
 		"PushBlock":    PushBlock,
+		"MerkleProof":  MerkleProof,
+		"GetTx":        GetTx,
 	}
 
 	// apiCalls = funcs.keys()
@@ -36,10 +40,16 @@ var (
 		"Txs",
 		"PushTx",
 		"PushBlock",
+		"MerkleProof",
+		"GetTx",
 	}
 )
 
 func SendCommand(peer string, req *Request) (*Response, error) {
+	if req.Version == "" {
+		req.Version = config.Get().Version
+	}
+
 	if length := tools.JSONLen(req); length < 1 || length > MaxMessageSize {
 		return nil, ErrSize
 	}
@@ -49,7 +59,13 @@ func SendCommand(peer string, req *Request) (*Response, error) {
 		return nil, fmt.Errorf("[server.SendCommand] net.Dial error: %v", err)
 	}
 
-	// Write request
+	defer conn.Close()
+
+	// Write request, after the magic of our network.
+	magic := config.Get().Magic
+	if _, err := conn.Write(magic[:]); err != nil {
+		return nil, fmt.Errorf("[server.SendCommand] conn.Write error: %v", err)
+	}
 	enc := json.NewEncoder(conn)
 	if err := enc.Encode(req); err != nil {
 		return nil, fmt.Errorf("[server.SendCommand] json.Marshal error: %v", err)
@@ -85,6 +101,13 @@ func Run(db *types.DB) {
 }
 
 func Main(conn net.Conn, db *types.DB) {
+	defer conn.Close()
+
+	if err := checkMagic(conn); err != nil {
+		logger.Println("Hanging up on", conn.RemoteAddr(), "error:", err)
+		return
+	}
+
 	var req Request
 	dec := json.NewDecoder(conn)
 	err := dec.Decode(&req)
@@ -96,6 +119,7 @@ func Main(conn net.Conn, db *types.DB) {
 	call := req.Type
 	if tools.NotIn(call, apiCalls) {
 		logger.Printf("Unknown service: %q\n", call)
+		return
 	}
 
 	resp := SecurityCheck(&req)
@@ -109,5 +133,22 @@ func Main(conn net.Conn, db *types.DB) {
 	// except:
 	//     pass
 	fn := funcs[call]
-	fn(&req, db)
+	resp = fn(&req, db)
+
+	enc := json.NewEncoder(conn)
+	if err := enc.Encode(resp); err != nil {
+		logger.Println("Couldn't encode response. Error:", err)
+	}
+}
+
+// checkMagic reads the magic a request starts with, it must be our network's.
+func checkMagic(r io.Reader) error {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return err
+	}
+	if magic != config.Get().Magic {
+		return ErrMagic
+	}
+	return nil
 }
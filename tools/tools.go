@@ -2,6 +2,7 @@ package tools
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -29,23 +30,44 @@ func ParseKeyPair(privkey string) (*btcec.PrivateKey, *btcec.PublicKey) {
 	return btcec.PrivKeyFromBytes(btcec.S256(), []byte(privkey))
 }
 
-// Deterministically takes hash (defaults to sha256) of dict, list, int, or string.
-// String representations, (what is feed into hash fn, in python+go pseudocode):
-// - list: fmt.Sprintf("[%s]", ",".join(map(det, sorted(payload))))
-// - dict: fmt.Sprintf("{%s}", ",".join(map(lambda p: det(p[0]) + ":" + det(p[1]), sorted(x.items()))))
-// - int: str(payload)
-// - string: payload
-// return hash_(json.loads(json.dumps(payload_string))))
+// Deterministically takes hash (defaults to sha256) of a block, tx, address, int or string.
+// Hashers are fed through their canonical binary encoding (see types.EncodingVersion),
+// so hashes don't depend on encoding/json, field order or Go versions.
+// Ints and strings are hashed as str(payload) and payload respectively.
 func DetHash(h types.Hasher) string { return config.Hash(h.Hash()) }
 func DetHashInt(h int) string       { return config.Hash(strconv.Itoa(h)) }
 func DetHashString(h string) string { return config.Hash(h) }
 
 // n is the number of pubkeys required to spend from this address.
+// Addresses start with the network's AddressPrefix.
 func MakeAddress(pubkeys []*btcec.PublicKey, n int) string {
 	addr := &types.Address{N: n, PubKeys: pubkeys}
 	h := DetHash(addr)
 	b58 := base58.Encode([]byte(h))
-	return fmt.Sprintf("%d%d%x", len(pubkeys), n, b58[:29])
+	return fmt.Sprintf("%s%d%d%x", config.Get().AddressPrefix, len(pubkeys), n, b58[:29])
+}
+
+// ValidAddress reports whether addr was made by MakeAddress for the configured
+// network: its prefix, the counts of pubkeys and signatures, then the hash.
+func ValidAddress(addr string) bool {
+	prefix := config.Get().AddressPrefix
+	if !strings.HasPrefix(addr, prefix) {
+		return false
+	}
+	body := addr[len(prefix):]
+
+	// Two digits at least, so another network's prefix isn't taken for one.
+	const hashLen = 2 * 29
+	if len(body) < hashLen+2 {
+		return false
+	}
+	for _, c := range body[:len(body)-hashLen] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	_, err := hex.DecodeString(body[len(body)-hashLen:])
+	return err == nil
 }
 
 func ZerosLeft(s string, size int) string {
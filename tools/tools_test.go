@@ -5,6 +5,8 @@ import (
 	"log"
 	"testing"
 
+	"github.com/toqueteos/altcoin/config"
+
 	"github.com/conformal/btcec"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -266,3 +268,39 @@ func TestMax(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeAddressPrefix(t *testing.T) {
+	_, pub := ParseKeyPair(DetHashString("prefix"))
+	pubkeys := []*btcec.PublicKey{pub}
+
+	Convey("Addresses start with the network's prefix", t, func() {
+		defer config.Set(config.Get())
+		mainnet := MakeAddress(pubkeys, 1)
+
+		config.Set(config.New(config.TestNet))
+		testnet := MakeAddress(pubkeys, 1)
+
+		So(testnet, ShouldStartWith, config.TestNet.AddressPrefix)
+		So(testnet, ShouldNotEqual, mainnet)
+		So(testnet[len(config.TestNet.AddressPrefix):], ShouldEqual, mainnet)
+	})
+
+	Convey("Only addresses of our network are valid", t, func() {
+		defer config.Set(config.Get())
+		mainnet := MakeAddress(pubkeys, 1)
+		So(ValidAddress(mainnet), ShouldBeTrue)
+		So(ValidAddress(MakeAddress(append(pubkeys, pub), 2)), ShouldBeTrue)
+
+		config.Set(config.New(config.TestNet))
+		testnet := MakeAddress(pubkeys, 1)
+		So(ValidAddress(testnet), ShouldBeTrue)
+		So(ValidAddress(mainnet), ShouldBeFalse)
+
+		config.Set(config.New(config.MainNet))
+		So(ValidAddress(testnet), ShouldBeFalse)
+		So(ValidAddress(""), ShouldBeFalse)
+		So(ValidAddress("someone"), ShouldBeFalse)
+		So(ValidAddress(mainnet[:len(mainnet)-1]), ShouldBeFalse)
+		So(ValidAddress(mainnet[:len(mainnet)-1]+"z"), ShouldBeFalse)
+	})
+}
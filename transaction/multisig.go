@@ -0,0 +1,143 @@
+package transaction
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/toqueteos/altcoin/coin"
+	"github.com/toqueteos/altcoin/tools"
+	"github.com/toqueteos/altcoin/types"
+
+	"github.com/conformal/btcec"
+)
+
+// Reasons for Sign and Combine to fail.
+var (
+	ErrNotOurKey    = errors.New("tx: key isn't one of the tx's pubkeys")
+	ErrFullySigned  = errors.New("tx: already has all its signatures")
+	ErrDifferentTxs = errors.New("tx: can't combine signatures of different txs")
+)
+
+// SigHash is what the signatures of tx sign: tx with its signatures left nil.
+// Their number is kept, it's the M of the address spent from and a signature
+// mustn't be good for another one.
+func SigHash(tx *types.Tx) string {
+	// tx_copy.pop("signatures")
+	// Work on a copy, tx itself must keep its signatures.
+	txCopy := *tx
+	txCopy.Signatures = make([]*btcec.Signature, len(tx.Signatures))
+	return tools.DetHash(&txCopy)
+}
+
+// NewSpend returns an unsigned spend from the m of n address of pubkeys, see
+// tools.MakeAddress. Its m signatures are left nil for Sign to fill, each
+// signer can sign their own copy and Combine them afterwards.
+func NewSpend(pubkeys []*btcec.PublicKey, m, count int, amount, fee coin.Amount, to string) *types.Tx {
+	return &types.Tx{
+		Type:       "spend",
+		Amount:     amount,
+		Count:      count,
+		Fee:        fee,
+		PubKeys:    pubkeys,
+		Signatures: make([]*btcec.Signature, m),
+		To:         to,
+	}
+}
+
+// Sign adds privkey's signature to tx, keeping the signatures in the order
+// of their pubkeys as SpendVerify wants them. Signing twice with the same key
+// does nothing.
+func Sign(tx *types.Tx, privkey *btcec.PrivateKey) error {
+	ours := privkey.PubKey().SerializeCompressed()
+	index := -1
+	for i, pub := range tx.PubKeys {
+		if pub != nil && bytes.Equal(pub.SerializeCompressed(), ours) {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return ErrNotOurKey
+	}
+
+	sigs := signatures(tx)
+	if sigs[index] != nil {
+		return nil
+	}
+	if len(sigs) >= len(tx.Signatures) {
+		return ErrFullySigned
+	}
+
+	sig, err := tools.Sign([]byte(SigHash(tx)), privkey)
+	if err != nil {
+		return err
+	}
+	sigs[index] = sig
+	setSignatures(tx, sigs)
+	return nil
+}
+
+// Combine returns tx with the signatures of every copy of it in txs, as
+// signed by different keys. Copies must be of the same tx for the same
+// number of signatures.
+func Combine(tx *types.Tx, txs ...*types.Tx) (*types.Tx, error) {
+	out := *tx
+	out.Signatures = make([]*btcec.Signature, len(tx.Signatures))
+	hash := SigHash(tx)
+
+	sigs := signatures(tx)
+	for _, t := range txs {
+		if SigHash(t) != hash || len(t.Signatures) != len(tx.Signatures) {
+			return nil, ErrDifferentTxs
+		}
+		for i, sig := range signatures(t) {
+			sigs[i] = sig
+		}
+	}
+	if len(sigs) > len(out.Signatures) {
+		return nil, ErrTooManySignatures
+	}
+
+	setSignatures(&out, sigs)
+	return &out, nil
+}
+
+// MissingSignatures is how many more keys must sign tx before SpendVerify
+// accepts it.
+func MissingSignatures(tx *types.Tx) int {
+	return len(tx.Signatures) - len(signatures(tx))
+}
+
+// signatures maps the index of each pubkey of tx to its signature, the ones
+// not signing SigHash(tx) are dropped.
+func signatures(tx *types.Tx) map[int]*btcec.Signature {
+	msg := []byte(SigHash(tx))
+	sigs := make(map[int]*btcec.Signature)
+	for _, sig := range tx.Signatures {
+		if sig == nil {
+			continue
+		}
+		for i, pub := range tx.PubKeys {
+			if _, ok := sigs[i]; !ok && pub != nil && tools.Verify(msg, sig, pub) {
+				sigs[i] = sig
+				break
+			}
+		}
+	}
+	return sigs
+}
+
+// setSignatures puts sigs in tx in the order of their pubkeys, followed by
+// nils for the ones still missing.
+func setSignatures(tx *types.Tx, sigs map[int]*btcec.Signature) {
+	out := make([]*btcec.Signature, 0, len(tx.Signatures))
+	for i := range tx.PubKeys {
+		if sig, ok := sigs[i]; ok {
+			out = append(out, sig)
+		}
+	}
+	for len(out) < len(tx.Signatures) {
+		out = append(out, nil)
+	}
+	tx.Signatures = out
+}
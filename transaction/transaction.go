@@ -3,92 +3,238 @@
 package transaction
 
 import (
+	"errors"
+
+	"github.com/toqueteos/altcoin/coin"
 	"github.com/toqueteos/altcoin/config"
+	"github.com/toqueteos/altcoin/reward"
 	"github.com/toqueteos/altcoin/tools"
 	"github.com/toqueteos/altcoin/types"
 
 	"github.com/conformal/btcec"
 )
 
-func SpendVerify(tx *types.Tx, txs []*types.Tx, db *types.DB) bool {
-	txCopy := tx
-	txCopy2 := tx
-
-	// tx_copy.pop("signatures")
-	txCopy.Signatures = nil
+// Reasons for a tx to fail verification.
+var (
+	ErrNoPubKeys         = errors.New("tx: no pubkeys")
+	ErrNoSignatures      = errors.New("tx: no signatures")
+	ErrTooManySignatures = errors.New("tx: more signatures than pubkeys")
+	ErrBadSignature      = errors.New("tx: signatures don't match")
+	ErrBadAmount         = errors.New("tx: amount must be positive")
+	ErrBadAddress        = errors.New("tx: to isn't an address of this network")
+	ErrFeeTooLow         = errors.New("tx: fee is below the minimum")
+	ErrInsufficientFunds = errors.New("tx: not enough funds")
+	ErrExtraMint         = errors.New("tx: only one mint per block")
+	ErrMintHeight        = errors.New("tx: mint isn't for the block it's in")
+	ErrBadMintAmount     = errors.New("tx: mint isn't the block reward plus fees")
+	ErrLatePremine       = errors.New("tx: premine outside the genesis block")
+)
 
+func SpendVerify(tx *types.Tx, txs []*types.Tx, db *types.DB) error {
 	if len(tx.PubKeys) == 0 {
-		return false
+		return ErrNoPubKeys
 	}
 
+	// The address of tx needs as many signatures as tx has, with none
+	// anybody could spend from it.
+	if len(tx.Signatures) == 0 {
+		return ErrNoSignatures
+	}
 	if len(tx.Signatures) > len(tx.PubKeys) {
-		return false
+		return ErrTooManySignatures
 	}
 
-	msg := tools.DetHash(txCopy)
-	if !sigsMatch(tx.Signatures, tx.PubKeys, msg) {
-		return false
+	if !sigsMatch(tx.Signatures, tx.PubKeys, SigHash(tx)) {
+		return ErrBadSignature
 	}
 
-	if tx.Amount < config.Get().Fee {
-		return false
+	if tx.Amount <= 0 {
+		return ErrBadAmount
+	}
+	if tx.Fee < config.Get().MinFee {
+		return ErrFeeTooLow
+	}
+	// Coins sent anywhere else would be lost.
+	if !tools.ValidAddress(tx.To) {
+		return ErrBadAddress
 	}
 
-	address := addr(txCopy2)
-	totalCost := 0
+	address := addr(tx)
+	length := db.Length + 1 // Of the block tx goes in.
+	maturity := config.Get().CoinbaseMaturity
 
+	// Pending mints are credited before checking spends against the balance,
+	// unless they need to mature first. Every step is overflow checked so
+	// huge amounts can't wrap around.
 	//for Tx in filter(lambda t: address == addr(t), [tx] + txs) {
-	for _, t := range append(txs, tx) {
-		if address == addr(t) {
+	acc, err := db.GetAccount(address)
+	if err != nil {
+		return err
+	}
+	balance, err := acc.Spendable(length)
+	if err != nil {
+		return err
+	}
+	all := append(txs[:len(txs):len(txs)], tx)
+	for _, t := range all {
+		if address != addr(t) {
 			continue
 		}
-		if t.Type == "spend" {
-			totalCost += t.Amount
+		if t.Type == "mint" && maturity == 0 {
+			if balance, err = balance.Add(t.Amount); err != nil {
+				return err
+			}
 		}
-		if t.Type == "mint" {
-			totalCost -= config.Get().BlockReward
+	}
+	for _, t := range all {
+		if address != addr(t) {
+			continue
+		}
+		if t.Type == "spend" {
+			cost, err := t.Amount.Add(t.Fee)
+			if err != nil {
+				return err
+			}
+			if balance, err = balance.Sub(cost); err == coin.ErrNegative {
+				return ErrInsufficientFunds
+			} else if err != nil {
+				return err
+			}
 		}
 	}
 
-	return db.GetAccount(address).Amount >= totalCost
+	return nil
 }
 
-// def sigs_match(sigs, pubs, msg):
-// 	return all(tools.verify(msg, sig, pub) for sig in sigs for pub in pubs)
+// sigsMatch reports whether each signature is of a different pubkey, in the
+// same order as pubs, like Bitcoin's OP_CHECKMULTISIG. That's how M of N
+// addresses are spent from: M signatures of any M of their N keys.
+//
+// basiccoin required every signature to match every pubkey, which only ever
+// worked with a single key.
 func sigsMatch(sigs []*btcec.Signature, pubs []*btcec.PublicKey, msg string) bool {
 	m := []byte(msg)
+	next := 0
 	for _, sig := range sigs {
-		for _, pub := range pubs {
-			if !tools.Verify(m, sig, pub) {
-				return false
-			}
+		if sig == nil {
+			return false
+		}
+		for next < len(pubs) && (pubs[next] == nil || !tools.Verify(m, sig, pubs[next])) {
+			next++
+		}
+		if next == len(pubs) {
+			return false
 		}
+		next++
 	}
 	return true
 }
 
-func MintVerify(tx *types.Tx, txs []*types.Tx, db *types.DB) bool {
+func MintVerify(tx *types.Tx, txs []*types.Tx, db *types.DB) error {
 	//return 0 == len(filter(lambda t: t["type"] == "mint", txs))
-	var n int
 	for _, t := range txs {
 		if t.Type == "mint" {
-			n++
+			return ErrExtraMint
+		}
+	}
+	if tx.Height != db.Length+1 {
+		return ErrMintHeight
+	}
+	return nil
+}
+
+// MintAmount is what the mint of the block at length with these txs must pay
+// its miner, the block reward (see reward.Block) plus every fee.
+func MintAmount(length int, txs []*types.Tx) (coin.Amount, error) {
+	amount := reward.Block(config.Get().ChainParams, length)
+	for _, t := range txs {
+		if t.Type != "spend" {
+			continue
+		}
+		var err error
+		if amount, err = amount.Add(t.Fee); err != nil {
+			return 0, err
 		}
 	}
-	return 0 == n
+	return amount, nil
 }
 
-func Mint(tx *types.Tx, db *types.DB) {
+// Mint credits tx.Amount, AddBlock already checked it against MintAmount.
+// It can't be spent for CoinbaseMaturity blocks.
+func Mint(tx *types.Tx, db *types.DB) error {
 	address := addr(tx)
-	adjust("amount", address, config.Get().BlockReward, db)
-	adjust("count", address, 1, db)
+	if err := adjustAmount(address, tx.Amount, db); err != nil {
+		return err
+	}
+	if maturity := config.Get().CoinbaseMaturity; maturity > 0 {
+		length := db.Length + 1
+		acc, err := db.GetAccount(address)
+		if err != nil {
+			return err
+		}
+		acc.Mature(length)
+		acc.Maturing = append(acc.Maturing, types.Maturing{Height: length + maturity, Amount: tx.Amount})
+		if err := db.PutAccount(address, acc); err != nil {
+			return err
+		}
+	}
+	return adjustCount(address, 1, db)
 }
 
-func Spend(tx *types.Tx, db *types.DB) {
+// Spend moves Amount to tx.To and Fee to the block's miner (see Mint).
+func Spend(tx *types.Tx, db *types.DB) error {
+	cost, err := tx.Amount.Add(tx.Fee)
+	if err != nil {
+		return err
+	}
+
 	address := addr(tx)
-	adjust("amount", address, -tx.Amount, db)
-	adjust("amount", tx.To, tx.Amount-config.Get().Fee, db)
-	adjust("count", address, 1, db)
+	if err := adjustAmount(address, -cost, db); err != nil {
+		return err
+	}
+	if err := adjustAmount(tx.To, tx.Amount, db); err != nil {
+		return err
+	}
+	return adjustCount(address, 1, db)
+}
+
+// PremineVerify only lets premine txs into the genesis block, which is built
+// out of ChainParams.Premine and checked against GenesisHash as a whole.
+func PremineVerify(tx *types.Tx, txs []*types.Tx, db *types.DB) error {
+	if db.Length >= 0 {
+		return ErrLatePremine
+	}
+	if tx.Amount <= 0 {
+		return ErrBadAmount
+	}
+	return nil
+}
+
+// Premine credits Amount to tx.To, nobody pays for it.
+func Premine(tx *types.Tx, db *types.DB) error {
+	return adjustAmount(tx.To, tx.Amount, db)
+}
+
+// MintHistory, SpendHistory and PremineHistory list the payments a tx makes, only the address,
+// direction and amount of each entry are filled in.
+func MintHistory(tx *types.Tx) []*types.HistoryEntry {
+	return []*types.HistoryEntry{
+		{Address: addr(tx), Direction: types.HistoryIn, Amount: tx.Amount},
+	}
+}
+
+func SpendHistory(tx *types.Tx) []*types.HistoryEntry {
+	cost, _ := tx.Amount.Add(tx.Fee)
+	return []*types.HistoryEntry{
+		{Address: addr(tx), Direction: types.HistoryOut, Amount: cost},
+		{Address: tx.To, Direction: types.HistoryIn, Amount: tx.Amount},
+	}
+}
+
+func PremineHistory(tx *types.Tx) []*types.HistoryEntry {
+	return []*types.HistoryEntry{
+		{Address: tx.To, Direction: types.HistoryIn, Amount: tx.Amount},
+	}
 }
 
 func addr(tx *types.Tx) string {
@@ -96,20 +242,30 @@ func addr(tx *types.Tx) string {
 }
 
 // adjust(key, pubkey, amount, DB, sign=1)
-func adjust(key string, addr string, value int, db *types.DB) {
-	var sign = 1
-
-	acc := db.GetAccount(addr)
-	if !db.AddBlock {
-		sign = -1
+// adjustAmount adds value (which may be negative) to the balance of addr.
+// Balances are never allowed to overflow or go below zero.
+// Updates only ever go forward, blocks are disconnected using their undo
+// record (see types.Undo) instead of running txs backwards.
+func adjustAmount(addr string, value coin.Amount, db *types.DB) error {
+	acc, err := db.GetAccount(addr)
+	if err != nil {
+		return err
 	}
 
-	switch key {
-	case "amount":
-		acc.Amount += value * sign
-	case "count":
-		acc.Count += value * sign
+	amount, err := acc.Amount.Add(value)
+	if err != nil {
+		return err
 	}
+	acc.Amount = amount
 
-	db.Put(addr, acc)
+	return db.PutAccount(addr, acc)
+}
+
+func adjustCount(addr string, value int, db *types.DB) error {
+	acc, err := db.GetAccount(addr)
+	if err != nil {
+		return err
+	}
+	acc.Count += value
+	return db.PutAccount(addr, acc)
 }
@@ -3,11 +3,63 @@ package types
 import (
 	"bytes"
 	"encoding/json"
+
+	"github.com/toqueteos/altcoin/coin"
 )
 
 type Account struct {
-	Amount int `json:"amount,omitempty"`
-	Count  int `json:"count,omitempty"`
+	Amount coin.Amount `json:"amount,omitempty"`
+	Count  int         `json:"count,omitempty"`
+
+	// Maturing are the mint rewards in Amount which may not be spendable
+	// yet, see config.ChainParams.CoinbaseMaturity.
+	Maturing []Maturing `json:"maturing,omitempty"`
+}
+
+// Maturing is a mint reward that can't be spent before the block at Height.
+type Maturing struct {
+	Height int         `json:"height"`
+	Amount coin.Amount `json:"amount"`
+}
+
+// Immature is how much of acc.Amount can't be spent in the block at length.
+func (acc *Account) Immature(length int) (coin.Amount, error) {
+	var total coin.Amount
+	for _, m := range acc.Maturing {
+		if m.Height <= length {
+			continue
+		}
+		var err error
+		if total, err = total.Add(m.Amount); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// Spendable is how much of acc.Amount can be spent in the block at length.
+func (acc *Account) Spendable(length int) (coin.Amount, error) {
+	immature, err := acc.Immature(length)
+	if err != nil {
+		return 0, err
+	}
+	spendable, err := acc.Amount.Sub(immature)
+	if err == coin.ErrNegative {
+		return 0, nil
+	}
+	return spendable, err
+}
+
+// Mature forgets the rewards spendable in the block at length, they're just
+// part of Amount from then on.
+func (acc *Account) Mature(length int) {
+	var maturing []Maturing
+	for _, m := range acc.Maturing {
+		if m.Height > length {
+			maturing = append(maturing, m)
+		}
+	}
+	acc.Maturing = maturing
 }
 
 func (acc *Account) JSON() string {
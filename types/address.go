@@ -1,8 +1,8 @@
 package types
 
 import (
+	"bytes"
 	"encoding/hex"
-	"fmt"
 	"sort"
 	"strings"
 
@@ -14,8 +14,10 @@ type Address struct {
 	PubKeys []*btcec.PublicKey `json:"pubkeys,omitempty"`
 }
 
+// Hash returns the canonical encoding of addr, see MarshalBinary.
+// PubKeys are sorted first so key order doesn't change the address.
 func (addr *Address) Hash() string {
-	return fmt.Sprintf("%d:[%s]", addr.N, addr.Sorted())
+	return string(addr.canonical())
 }
 
 func (addr *Address) Sorted() string {
@@ -28,3 +30,43 @@ func (addr *Address) Sorted() string {
 	sort.Strings(pks)
 	return strings.Join(pks, ",")
 }
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (addr *Address) MarshalBinary() ([]byte, error) {
+	return addr.canonical(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (addr *Address) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data)
+	addr.N = d.int()
+	addr.PubKeys = d.pubKeys()
+	return d.finish()
+}
+
+// Field order: N, PubKeys (sorted by compressed form).
+func (addr *Address) canonical() []byte {
+	pks := make([]*btcec.PublicKey, len(addr.PubKeys))
+	copy(pks, addr.PubKeys)
+	sort.Sort(byCompressed(pks))
+
+	e := newEncoder()
+	e.int(addr.N)
+	e.pubKeys(pks)
+	return e.Bytes()
+}
+
+type byCompressed []*btcec.PublicKey
+
+func (b byCompressed) Len() int      { return len(b) }
+func (b byCompressed) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byCompressed) Less(i, j int) bool {
+	return bytes.Compare(compressed(b[i]), compressed(b[j])) < 0
+}
+
+func compressed(pub *btcec.PublicKey) []byte {
+	if pub == nil {
+		return nil
+	}
+	return pub.SerializeCompressed()
+}
@@ -3,24 +3,20 @@ package types
 import (
 	"bytes"
 	"encoding/json"
-	"math/big"
-	"time"
 )
 
+// Block is a BlockHeader plus the transactions its MerkleRoot commits to.
 type Block struct {
-	DiffLength string    `json:"difflength,omitempty"`
-	Error      error     `json:"error,omitempty"`
-	Length     int       `json:"length,omitempty"`
-	Nonce      *big.Int  `json:"nonce,omitempty"`
-	PrevHash   string    `json:"prevhash,omitempty"`
-	Target     string    `json:"target,omitempty"`
-	Time       time.Time `json:"time,omitempty"`
-	Txs        []*Tx     `json:"txs,omitempty"`
-	Version    string    `json:"version,omitempty"`
+	BlockHeader
+	Error  error `json:"error,omitempty"`
+	Length int   `json:"length,omitempty"`
+	Txs    []*Tx `json:"txs,omitempty"`
 }
 
+// Hash returns the canonical encoding of the block's header, so a block and
+// its header always share the same hash.
 func (b *Block) Hash() string {
-	return b.JSON()
+	return b.BlockHeader.Hash()
 }
 
 func (b *Block) JSON() string {
@@ -30,3 +26,47 @@ func (b *Block) JSON() string {
 
 	return buf.String()
 }
+
+// MerkleProof returns the inclusion proof for the tx at index.
+func (b *Block) MerkleProof(index int) ([]MerkleStep, error) {
+	return MerkleProof(b.Txs, index)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// Unlike Hash it covers the whole block, not just the header.
+// Error is local bookkeeping and never part of it.
+func (b *Block) MarshalBinary() ([]byte, error) {
+	e := newEncoder()
+	b.encode(e)
+	return e.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (b *Block) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data)
+	b.decode(d)
+	return d.finish()
+}
+
+// Field order: BlockHeader, Length, Txs.
+func (b *Block) encode(e *encoder) {
+	b.BlockHeader.encode(e)
+	e.int(b.Length)
+	e.uvarint(uint64(len(b.Txs)))
+	for _, tx := range b.Txs {
+		tx.encode(e)
+	}
+}
+
+func (b *Block) decode(d *decoder) {
+	b.BlockHeader.decode(d)
+	b.Length = d.int()
+
+	n := d.count()
+	b.Txs = nil
+	for i := 0; i < n && d.err == nil; i++ {
+		tx := new(Tx)
+		tx.decode(d)
+		b.Txs = append(b.Txs, tx)
+	}
+}
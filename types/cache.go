@@ -0,0 +1,89 @@
+package types
+
+import (
+	"container/list"
+	"sync"
+)
+
+// HeaderCache keeps the headers of the most recently used main chain blocks by
+// length, so retargeting doesn't decode the same blocks over and over. Once
+// full the least recently used header goes.
+//
+// It's safe for concurrent use, readers holding DB's RLock fill it at once.
+type HeaderCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List // Front is the most recently used.
+	items map[int]*list.Element
+}
+
+type cachedHeader struct {
+	length int
+	header *BlockHeader
+}
+
+// NewHeaderCache returns a cache holding up to size headers, none if size <= 0.
+func NewHeaderCache(size int) *HeaderCache {
+	return &HeaderCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[int]*list.Element),
+	}
+}
+
+// Get returns the cached header at length. It's shared, don't modify it.
+func (c *HeaderCache) Get(length int) (*BlockHeader, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[length]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*cachedHeader).header, true
+}
+
+func (c *HeaderCache) Add(length int, h *BlockHeader) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size <= 0 {
+		return
+	}
+	if el, ok := c.items[length]; ok {
+		el.Value.(*cachedHeader).header = h
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[length] = c.ll.PushFront(&cachedHeader{length, h})
+	if c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+// Truncate forgets every header at length or above, they no longer are the
+// main chain's once the block at length is disconnected.
+func (c *HeaderCache) Truncate(length int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for l, el := range c.items {
+		if l >= length {
+			c.remove(el)
+		}
+	}
+}
+
+func (c *HeaderCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+func (c *HeaderCache) remove(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*cachedHeader).length)
+}
@@ -0,0 +1,36 @@
+package types
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHeaderCache(t *testing.T) {
+	Convey("The least recently used header goes first", t, func() {
+		c := NewHeaderCache(2)
+		c.Add(0, &BlockHeader{Bits: 0})
+		c.Add(1, &BlockHeader{Bits: 1})
+		c.Get(0)
+		c.Add(2, &BlockHeader{Bits: 2})
+
+		_, ok := c.Get(1)
+		So(ok, ShouldBeFalse)
+		h, ok := c.Get(0)
+		So(ok, ShouldBeTrue)
+		So(h.Bits, ShouldEqual, 0)
+		So(c.Len(), ShouldEqual, 2)
+	})
+
+	Convey("Truncate forgets everything from a length on", t, func() {
+		c := NewHeaderCache(10)
+		for i := 0; i < 5; i++ {
+			c.Add(i, &BlockHeader{})
+		}
+		c.Truncate(3)
+
+		So(c.Len(), ShouldEqual, 3)
+		_, ok := c.Get(3)
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -2,10 +2,16 @@ package types
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"strconv"
+	"sync"
+
+	"github.com/toqueteos/altcoin/clock"
+	"github.com/toqueteos/altcoin/config"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
 func NewDB(db *leveldb.DB) *DB {
@@ -14,22 +20,154 @@ func NewDB(db *leveldb.DB) *DB {
 	}
 
 	return &DB{
-		Length:    -1,
-		SigLength: -1,
-		Storage:   db,
+		Clock:      clock.System,
+		DiffLength: NewWork(0),
+		Headers:    NewHeaderCache(config.Get().HeaderCacheSize),
+		Index:      NewBlockIndex(),
+		Length:     -1,
+		SigLength:  -1,
+		Storage:    db,
+	}
+}
+
+// ErrTipMismatch means the stored tip doesn't describe the block stored at its
+// length, the database was modified behind our back or is corrupt.
+var ErrTipMismatch = errors.New("types: stored tip doesn't match the chain")
+
+// OpenChain wraps an existing database, picking up the chain where the last
+// run left it instead of starting over from genesis.
+func OpenChain(ldb *leveldb.DB) (*DB, error) {
+	db := NewDB(ldb)
+	if err := db.Migrate(); err != nil {
+		return nil, err
+	}
+	if err := db.checkEncoding(); err != nil {
+		return nil, err
+	}
+
+	tip := db.GetTip()
+	if tip == nil {
+		// Databases written before tips were stored.
+		if tip = db.scanTip(); tip != nil {
+			if err := db.PutTip(tip); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := db.Recover(); err != nil {
+		return nil, err
+	}
+	if tip == nil {
+		return db, nil
+	}
+
+	b := db.GetBlock(tip.Length)
+	if b == nil || config.Hash(b.Hash()) != tip.Hash || b.DiffLength.Cmp(tip.DiffLength) != 0 {
+		return nil, ErrTipMismatch
 	}
+
+	db.Length = tip.Length
+	db.DiffLength = tip.DiffLength
+	return db, nil
 }
 
+// scanTip builds a tip out of the last of the consecutive blocks from genesis.
+func (db *DB) scanTip() *Tip {
+	var last *Block
+	for n := 0; ; n++ {
+		b := db.GetBlock(n)
+		if b == nil {
+			break
+		}
+		last = b
+	}
+	if last == nil {
+		return nil
+	}
+	return &Tip{Length: last.Length, Hash: config.Hash(last.Hash()), DiffLength: last.DiffLength}
+}
+
+// DB is shared by every goroutine of a node. Its own methods don't lock, whoever
+// reads chain state (Length, DiffLength, blocks, accounts...) holds RLock and
+// whoever changes it holds Lock. The exported functions of package blockchain
+// take care of it, everybody else locks by hand.
 type DB struct {
-	AddBlock        bool
-	DiffLength      string
+	sync.RWMutex
+
+	Clock           clock.Clock // What block times are checked against.
+	DiffLength      *Work
+	Headers         *HeaderCache // Main chain headers, see GetHeader.
+	Index           *BlockIndex
 	Length          int
 	RecentHash      int
 	SigLength       int
 	Storage         *leveldb.DB
 	SuggestedBlocks []*Block
 	SuggestedTxs    []*Tx
-	Txs             []*Tx
+	Pool            TxPool // Txs waiting to be mined, set before use.
+
+	// AddressIndex keeps a history of payments per address, see GetHistory.
+	// Blocks connected while it was off aren't in the history.
+	AddressIndex bool
+
+	undo *Undo // Non-nil while a block is being connected, see StartUndo.
+
+	// Non-nil between Begin and Commit/Discard, writes go to batch and reads
+	// see them through pending (a nil value means deleted).
+	batch   *leveldb.Batch
+	pending map[string][]byte
+}
+
+// Begin starts buffering every write until Commit, so connecting or
+// disconnecting a block either fully happens or doesn't happen at all.
+// Reads done meanwhile already see the buffered writes.
+func (db *DB) Begin() {
+	db.batch = new(leveldb.Batch)
+	db.pending = make(map[string][]byte)
+}
+
+// Commit atomically writes everything since Begin, synced to disk.
+func (db *DB) Commit() error {
+	batch := db.batch
+	db.Discard()
+	return db.Storage.Write(batch, &opt.WriteOptions{Sync: true})
+}
+
+// Discard forgets everything written since Begin.
+func (db *DB) Discard() {
+	db.batch = nil
+	db.pending = nil
+}
+
+func (db *DB) get(k string) ([]byte, error) {
+	if db.batch != nil {
+		if value, ok := db.pending[k]; ok {
+			if value == nil {
+				return nil, leveldb.ErrNotFound
+			}
+			return value, nil
+		}
+	}
+	return db.Storage.Get([]byte(k), nil)
+}
+
+func (db *DB) put(k string, value []byte) error {
+	if db.batch != nil {
+		db.batch.Put([]byte(k), value)
+		db.pending[k] = value
+		return nil
+	}
+	return db.Storage.Put([]byte(k), value, nil)
+}
+
+func (db *DB) delete(k string) error {
+	if db.batch != nil {
+		db.batch.Delete([]byte(k))
+		db.pending[k] = nil
+		return nil
+	}
+	return db.Storage.Delete([]byte(k), nil)
 }
 
 // def db_get(n, DB):
@@ -42,61 +180,231 @@ type DB struct {
 //         return db_get(n, DB)
 
 func (db *DB) GetBlock(blockNum int) *Block {
-	num := strconv.Itoa(blockNum)
-	key := []byte(num)
-
-	value, err := db.Storage.Get(key, nil)
+	value, err := db.get(blockKey(blockNum))
 	if err != nil {
 		return nil
 	}
 
 	var b Block
-	if err := json.Unmarshal(value, &b); err != nil {
+	if err := b.UnmarshalBinary(value); err != nil {
+		log.Println("GetBlock error:", err)
 		return nil
 	}
 
 	return &b
 }
 
-func (db *DB) GetAccount(addr string) *Account {
-	key := []byte(addr)
+// GetHeader returns the header of the main chain block at length, nil if
+// there is none. Headers are cached in db.Headers, which whoever disconnects a
+// block must Truncate. The header is shared, don't modify it.
+func (db *DB) GetHeader(length int) *BlockHeader {
+	if h, ok := db.Headers.Get(length); ok {
+		return h
+	}
 
-	value, err := db.Storage.Get(key, nil)
+	b := db.GetBlock(length)
+	if b == nil {
+		return nil
+	}
+	// Blocks of a batch not committed yet may still be discarded.
+	if db.batch == nil {
+		db.Headers.Add(length, &b.BlockHeader)
+	}
+	return &b.BlockHeader
+}
+
+// GetBlockByHash returns the main chain block with the given hash (as in
+// tools.DetHash), nil if there is none.
+func (db *DB) GetBlockByHash(hash string) *Block {
+	value, err := db.get(hashKey(hash))
+	if err != nil {
+		return nil
+	}
+
+	length, err := strconv.Atoi(string(value))
+	if err != nil {
+		log.Println("GetBlockByHash error:", err)
+		return nil
+	}
+	return db.GetBlock(length)
+}
+
+// PutBlock stores b under its length using the canonical binary encoding.
+func (db *DB) PutBlock(b *Block) error {
+	value, err := b.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := db.put(hashKey(config.Hash(b.Hash())), []byte(strconv.Itoa(b.Length))); err != nil {
+		return err
+	}
+	if err := db.indexTxs(b); err != nil {
+		return err
+	}
+	return db.put(blockKey(b.Length), value)
+}
+
+// DeleteBlock removes the block at length and forgets every cached header from
+// length on, they can't be trusted to stay the main chain's.
+func (db *DB) DeleteBlock(length int) error {
+	db.Headers.Truncate(length)
+	if b := db.GetBlock(length); b != nil {
+		if err := db.delete(hashKey(config.Hash(b.Hash()))); err != nil {
+			return err
+		}
+		if err := db.unindexTxs(b); err != nil {
+			return err
+		}
+	}
+	return db.delete(blockKey(length))
+}
+
+// GetAccount never fails for unknown addresses, everyone defaults with having
+// zero money and having broadcast zero transactions. Accounts that can't be
+// read are an error, not an empty account.
+// Unlike basiccoin nothing is written until the account actually changes.
+func (db *DB) GetAccount(addr string) (*Account, error) {
+	value, err := db.get(accountKey(addr))
 	switch err {
 	case leveldb.ErrNotFound:
-		// // Everyone defaults with having zero money, and having broadcast zero transactions.
-		// db_put(n, {"count": 0, "amount": 0}, db)
-		// return db_get(n, db)
-		db.Put(addr, &Account{Count: 0, Amount: 0})
-		return db.GetAccount(addr)
+		return &Account{Count: 0, Amount: 0}, nil
 	case nil:
-		// Nothing!
+		return decodeAccount(value)
 	default:
-		log.Println("GetAccount error:", err)
-		return nil
+		return nil, err
 	}
+}
 
+func decodeAccount(value []byte) (*Account, error) {
 	var acc Account
 	if err := json.Unmarshal(value, &acc); err != nil {
+		return nil, err
+	}
+	return &acc, nil
+}
+
+// PutAccount stores acc, remembering what addr held before if an undo record
+// is being built.
+func (db *DB) PutAccount(addr string, acc *Account) error {
+	if db.undo != nil {
+		if _, seen := db.undo.Accounts[addr]; !seen {
+			var prev *Account
+			if _, err := db.get(accountKey(addr)); err == nil {
+				if prev, err = db.GetAccount(addr); err != nil {
+					return err
+				}
+			}
+			db.undo.Accounts[addr] = prev
+		}
+	}
+	return db.Put(accountKey(addr), acc)
+}
+
+// StartUndo makes PutAccount record previous account states until FinishUndo.
+func (db *DB) StartUndo() {
+	db.undo = NewUndo()
+}
+
+// FinishUndo stops recording and returns what was recorded.
+func (db *DB) FinishUndo() *Undo {
+	u := db.undo
+	db.undo = nil
+	return u
+}
+
+// RestoreUndo puts back every account exactly as u recorded it.
+func (db *DB) RestoreUndo(u *Undo) error {
+	for addr, acc := range u.Accounts {
+		var err error
+		if acc == nil {
+			err = db.Delete(accountKey(addr))
+		} else {
+			err = db.Put(accountKey(addr), acc)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUndo returns the undo record of the block at length, nil if missing.
+func (db *DB) GetUndo(length int) *Undo {
+	value, err := db.get(undoKey(length))
+	if err != nil {
+		return nil
+	}
+
+	var u Undo
+	if err := json.Unmarshal(value, &u); err != nil {
 		log.Println("json.Unmarshal error:", err)
 		return nil
 	}
-	return &acc
+	return &u
+}
+
+func (db *DB) PutUndo(length int, u *Undo) error { return db.Put(undoKey(length), u) }
+func (db *DB) DeleteUndo(length int) error       { return db.Delete(undoKey(length)) }
+
+// GetTip returns the last committed chain tip, nil for an empty chain.
+func (db *DB) GetTip() *Tip {
+	value, err := db.get(metaKey("tip"))
+	if err != nil {
+		return nil
+	}
+
+	var tip Tip
+	if err := json.Unmarshal(value, &tip); err != nil {
+		log.Println("json.Unmarshal error:", err)
+		return nil
+	}
+	return &tip
+}
+
+// PutTip records tip, nil means the chain is empty.
+func (db *DB) PutTip(tip *Tip) error {
+	if tip == nil {
+		return db.Delete(metaKey("tip"))
+	}
+	return db.Put(metaKey("tip"), tip)
+}
+
+// Recover drops whatever is stored above the committed tip, leftovers from
+// writes done before blocks were written atomically, so blocks and undo
+// records always agree with it.
+func (db *DB) Recover() error {
+	length := -1
+	if tip := db.GetTip(); tip != nil {
+		length = tip.Length
+	}
+
+	for n := length + 1; ; n++ {
+		_, blockErr := db.get(blockKey(n))
+		_, undoErr := db.get(undoKey(n))
+		if blockErr == leveldb.ErrNotFound && undoErr == leveldb.ErrNotFound {
+			return nil
+		}
+
+		log.Println("Recover: dropping block", n, "above the committed tip")
+		if err := db.DeleteBlock(n); err != nil {
+			return err
+		}
+		if err := db.DeleteUndo(n); err != nil {
+			return err
+		}
+	}
 }
 
 // def db_put(key, dic, DB):
 //     return DB['db'].Put(str(key), tools.package(dic))
 
 func (db *DB) Put(k string, v Serializer) error {
-	key := []byte(k)
-	value := []byte(v.JSON())
-	return db.Storage.Put(key, value, nil)
+	return db.put(k, []byte(v.JSON()))
 }
 
 // def db_delete(key, DB):
 //     return DB['db'].Delete(str(key))
 
 func (db *DB) Delete(k string) error {
-	key := []byte(k)
-	return db.Storage.Delete(key, nil)
+	return db.delete(k)
 }
@@ -0,0 +1,25 @@
+package types
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+func TestGetAccount(t *testing.T) {
+	Convey("Unreadable accounts aren't empty ones", t, func() {
+		ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+		So(err, ShouldBeNil)
+		db := NewDB(ldb)
+
+		acc, err := db.GetAccount("addr")
+		So(err, ShouldBeNil)
+		So(*acc, ShouldResemble, Account{})
+
+		So(ldb.Put([]byte(accountKey("addr")), []byte(`{"amount":`), nil), ShouldBeNil)
+		_, err = db.GetAccount("addr")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,287 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/toqueteos/altcoin/coin"
+
+	"github.com/conformal/btcec"
+)
+
+// EncodingVersion is the first byte of every canonical encoding.
+// Bump it whenever the layout below changes so old hashes keep their meaning.
+//
+// Layout rules (all integers are little endian varints, see encoding/binary):
+// - int, coin.Amount: zig-zag varint (amounts in base units).
+// - string, []byte: uvarint length followed by the raw bytes.
+// - *big.Int: one marker byte (0 nil, 1 positive or zero, 2 negative) followed by its absolute value as []byte.
+// - time.Time: zig-zag varint seconds since Unix epoch, then uvarint nanoseconds.
+// - *btcec.PublicKey: 33 byte compressed form as []byte, empty for nil.
+// - *btcec.Signature: DER form as []byte, empty for nil.
+// - slices: uvarint length followed by each element.
+// Struct fields are written in the order documented on each encode method.
+//
+// Versions: 1 first one, 2 added Tx.Fee, 3 made BlockHeader's Target the
+// compact Bits and DiffLength a number, 4 added Tx.Height.
+const EncodingVersion byte = 4
+
+var (
+	ErrEncodingVersion = errors.New("types: unknown encoding version")
+	ErrEncodingShort   = errors.New("types: unexpected end of encoded data")
+	ErrEncodingTrail   = errors.New("types: trailing bytes after encoded data")
+	ErrEncodingBigInt  = errors.New("types: invalid big.Int marker")
+)
+
+type encoder struct {
+	buf bytes.Buffer
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func newEncoder() *encoder {
+	e := &encoder{}
+	e.buf.WriteByte(EncodingVersion)
+	return e
+}
+
+func (e *encoder) Bytes() []byte { return e.buf.Bytes() }
+
+func (e *encoder) uvarint(n uint64) {
+	size := binary.PutUvarint(e.tmp[:], n)
+	e.buf.Write(e.tmp[:size])
+}
+
+func (e *encoder) int(n int) {
+	size := binary.PutVarint(e.tmp[:], int64(n))
+	e.buf.Write(e.tmp[:size])
+}
+
+func (e *encoder) amount(a coin.Amount) {
+	size := binary.PutVarint(e.tmp[:], int64(a))
+	e.buf.Write(e.tmp[:size])
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf.Write(b)
+}
+
+func (e *encoder) string(s string) { e.bytes([]byte(s)) }
+
+func (e *encoder) bigInt(n *big.Int) {
+	switch {
+	case n == nil:
+		e.buf.WriteByte(0)
+		return
+	case n.Sign() < 0:
+		e.buf.WriteByte(2)
+	default:
+		e.buf.WriteByte(1)
+	}
+	e.bytes(new(big.Int).Abs(n).Bytes())
+}
+
+func (e *encoder) time(t time.Time) {
+	size := binary.PutVarint(e.tmp[:], t.Unix())
+	e.buf.Write(e.tmp[:size])
+	e.uvarint(uint64(t.Nanosecond()))
+}
+
+func (e *encoder) pubKeys(pks []*btcec.PublicKey) {
+	e.uvarint(uint64(len(pks)))
+	for _, pub := range pks {
+		if pub == nil {
+			e.bytes(nil)
+			continue
+		}
+		e.bytes(pub.SerializeCompressed())
+	}
+}
+
+func (e *encoder) signatures(sigs []*btcec.Signature) {
+	e.uvarint(uint64(len(sigs)))
+	for _, sig := range sigs {
+		if sig == nil {
+			e.bytes(nil)
+			continue
+		}
+		e.bytes(sig.Serialize())
+	}
+}
+
+// decoder keeps the first error it finds, every read after that is a no-op.
+// Callers only need to check err once they are done.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func newDecoder(b []byte) *decoder {
+	d := &decoder{b: b}
+	if len(b) == 0 {
+		d.err = ErrEncodingShort
+		return d
+	}
+	if b[0] != EncodingVersion {
+		d.err = ErrEncodingVersion
+		return d
+	}
+	d.b = b[1:]
+	return d
+}
+
+// finish reports the first error found or complains about leftovers.
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.b) > 0 {
+		d.err = ErrEncodingTrail
+	}
+	return d.err
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(d.b)
+	if size <= 0 {
+		d.err = ErrEncodingShort
+		return 0
+	}
+	d.b = d.b[size:]
+	return n
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Varint(d.b)
+	if size <= 0 {
+		d.err = ErrEncodingShort
+		return 0
+	}
+	d.b = d.b[size:]
+	return n
+}
+
+func (d *decoder) int() int { return int(d.varint()) }
+
+func (d *decoder) amount() coin.Amount { return coin.Amount(d.varint()) }
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.b) < 1 {
+		d.err = ErrEncodingShort
+		return 0
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c
+}
+
+func (d *decoder) bytes() []byte {
+	size := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.b)) < size {
+		d.err = ErrEncodingShort
+		return nil
+	}
+	b := d.b[:size]
+	d.b = d.b[size:]
+	return b
+}
+
+func (d *decoder) string() string { return string(d.bytes()) }
+
+func (d *decoder) bigInt() *big.Int {
+	marker := d.byte()
+	if d.err != nil || marker == 0 {
+		return nil
+	}
+	if marker > 2 {
+		d.err = ErrEncodingBigInt
+		return nil
+	}
+	n := new(big.Int).SetBytes(d.bytes())
+	if marker == 2 {
+		n.Neg(n)
+	}
+	return n
+}
+
+func (d *decoder) time() time.Time {
+	sec := d.varint()
+	nsec := d.uvarint()
+	if d.err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, int64(nsec)).UTC()
+}
+
+// count reads a slice length, refusing lengths that can't possibly fit in
+// what's left so a malicious peer can't make us allocate huge slices.
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if d.err == nil && n > uint64(len(d.b)) {
+		d.err = ErrEncodingShort
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) pubKeys() []*btcec.PublicKey {
+	n := d.count()
+	if d.err != nil || n == 0 {
+		return nil
+	}
+
+	pks := make([]*btcec.PublicKey, n)
+	for i := range pks {
+		b := d.bytes()
+		if d.err != nil {
+			return nil
+		}
+		if len(b) == 0 {
+			continue
+		}
+		pub, err := btcec.ParsePubKey(b, btcec.S256())
+		if err != nil {
+			d.err = err
+			return nil
+		}
+		pks[i] = pub
+	}
+	return pks
+}
+
+func (d *decoder) signatures() []*btcec.Signature {
+	n := d.count()
+	if d.err != nil || n == 0 {
+		return nil
+	}
+
+	sigs := make([]*btcec.Signature, n)
+	for i := range sigs {
+		b := d.bytes()
+		if d.err != nil {
+			return nil
+		}
+		if len(b) == 0 {
+			continue
+		}
+		sig, err := btcec.ParseSignature(b, btcec.S256())
+		if err != nil {
+			d.err = err
+			return nil
+		}
+		sigs[i] = sig
+	}
+	return sigs
+}
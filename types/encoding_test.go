@@ -0,0 +1,166 @@
+package types
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/conformal/btcec"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testKey(b byte) (*btcec.PrivateKey, *btcec.PublicKey) {
+	seed := make([]byte, 32)
+	seed[31] = b
+	return btcec.PrivKeyFromBytes(btcec.S256(), seed)
+}
+
+func testTx() *Tx {
+	priv, pub := testKey(1)
+	sig, err := priv.Sign(make([]byte, 32))
+	if err != nil {
+		panic(err)
+	}
+
+	return &Tx{
+		Amount:     -42,
+		Count:      7,
+		PubKeys:    []*btcec.PublicKey{pub},
+		Signatures: []*btcec.Signature{sig},
+		To:         "someone",
+		Type:       "spend",
+	}
+}
+
+func TestTxEncoding(t *testing.T) {
+	Convey("Tx survives a round trip", t, func() {
+		tx := testTx()
+		data, err := tx.MarshalBinary()
+		So(err, ShouldBeNil)
+
+		var out Tx
+		So(out.UnmarshalBinary(data), ShouldBeNil)
+		So(out.Hash(), ShouldEqual, tx.Hash())
+		So(out.Amount, ShouldEqual, -42)
+		So(out.PubKeys[0].IsEqual(tx.PubKeys[0]), ShouldBeTrue)
+	})
+
+	Convey("nil signatures are kept in place", t, func() {
+		tx := &Tx{Type: "mint", Signatures: []*btcec.Signature{nil}}
+
+		var out Tx
+		So(out.UnmarshalBinary([]byte(tx.Hash())), ShouldBeNil)
+		So(len(out.Signatures), ShouldEqual, 1)
+		So(out.Signatures[0], ShouldBeNil)
+	})
+
+	Convey("Encoding is pinned", t, func() {
+		tx := &Tx{Amount: 1, Count: 2, Fee: 3, Height: 4, To: "a", Type: "b"}
+		So(hex.EncodeToString([]byte(tx.Hash())), ShouldEqual, "0402040608000001610162")
+	})
+
+	Convey("Older encodings are refused", t, func() {
+		for _, vector := range []string{
+			"010204000001610162",   // Version 1, before Fee.
+			"02020406000001610162", // Version 2.
+			"03020406000001610162", // Version 3, before Height.
+		} {
+			old, err := hex.DecodeString(vector)
+			So(err, ShouldBeNil)
+
+			var out Tx
+			So(out.UnmarshalBinary(old), ShouldEqual, ErrEncodingVersion)
+		}
+	})
+}
+
+func TestBlockEncoding(t *testing.T) {
+	txs := []*Tx{testTx(), {Type: "mint"}}
+	block := &Block{
+		BlockHeader: BlockHeader{
+			Version:    "v1",
+			PrevHash:   "abcd",
+			MerkleRoot: MerkleRoot(txs),
+			Time:       time.Unix(1400000000, 5),
+			Bits:       0x1d00ffff,
+			DiffLength: NewWork(255),
+			Nonce:      big.NewInt(1234567),
+		},
+		Length: 3,
+		Txs:    txs,
+	}
+
+	Convey("Block survives a round trip", t, func() {
+		data, err := block.MarshalBinary()
+		So(err, ShouldBeNil)
+
+		var out Block
+		So(out.UnmarshalBinary(data), ShouldBeNil)
+		So(out.Hash(), ShouldEqual, block.Hash())
+		So(out.Time.Equal(block.Time), ShouldBeTrue)
+		So(out.Length, ShouldEqual, 3)
+		So(len(out.Txs), ShouldEqual, 2)
+	})
+
+	Convey("Header encoding is pinned", t, func() {
+		header := &BlockHeader{Version: "v", Time: time.Unix(1, 0), Bits: 0x1d00ffff, DiffLength: NewWork(1), Nonce: big.NewInt(3)}
+		So(hex.EncodeToString([]byte(header.Hash())), ShouldEqual, "04017600000200ffff83e801010101010103")
+	})
+
+	Convey("Block and header share their hash", t, func() {
+		var header BlockHeader
+		So(header.UnmarshalBinary([]byte(block.Hash())), ShouldBeNil)
+		So(header.Hash(), ShouldEqual, block.Hash())
+	})
+
+	Convey("Error doesn't affect the hash", t, func() {
+		withErr := *block
+		withErr.Error = errors.New("boom")
+		So(withErr.Hash(), ShouldEqual, block.Hash())
+	})
+
+	Convey("nil and zero nonces differ", t, func() {
+		a, b := *block, *block
+		a.Nonce = nil
+		b.Nonce = new(big.Int)
+		So(a.Hash(), ShouldNotEqual, b.Hash())
+	})
+
+	Convey("Bad input is rejected", t, func() {
+		data, _ := block.MarshalBinary()
+		var out Block
+		So(out.UnmarshalBinary(data[:len(data)-1]), ShouldEqual, ErrEncodingShort)
+		So(out.UnmarshalBinary(append(data, 0)), ShouldEqual, ErrEncodingTrail)
+
+		data[0] = EncodingVersion + 1
+		So(out.UnmarshalBinary(data), ShouldEqual, ErrEncodingVersion)
+	})
+}
+
+func TestAddressEncoding(t *testing.T) {
+	_, a := testKey(1)
+	_, b := testKey(2)
+
+	Convey("PubKey order doesn't matter", t, func() {
+		ab := &Address{N: 1, PubKeys: []*btcec.PublicKey{a, b}}
+		ba := &Address{N: 1, PubKeys: []*btcec.PublicKey{b, a}}
+		So(ab.Hash(), ShouldEqual, ba.Hash())
+
+		var out Address
+		So(out.UnmarshalBinary([]byte(ab.Hash())), ShouldBeNil)
+		So(out.Hash(), ShouldEqual, ab.Hash())
+	})
+}
+
+func TestHalfWayEncoding(t *testing.T) {
+	Convey("HalfWay survives a round trip", t, func() {
+		h := &HalfWay{HalfHash: "abc", Nonce: big.NewInt(-5)}
+
+		var out HalfWay
+		So(out.UnmarshalBinary([]byte(h.Hash())), ShouldBeNil)
+		So(out.HalfHash, ShouldEqual, "abc")
+		So(out.Nonce.Int64(), ShouldEqual, -5)
+	})
+}
@@ -1,8 +1,6 @@
 package types
 
 import (
-	"bytes"
-	"encoding/json"
 	"math/big"
 )
 
@@ -11,10 +9,28 @@ type HalfWay struct {
 	Nonce    *big.Int `json:"nonce,omitempty"`
 }
 
+// Hash returns the canonical encoding of h, see MarshalBinary.
 func (h *HalfWay) Hash() string {
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
-	enc.Encode(h)
+	return string(h.canonical())
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (h *HalfWay) MarshalBinary() ([]byte, error) {
+	return h.canonical(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (h *HalfWay) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data)
+	h.HalfHash = d.string()
+	h.Nonce = d.bigInt()
+	return d.finish()
+}
 
-	return buf.String()
+// Field order: HalfHash, Nonce.
+func (h *HalfWay) canonical() []byte {
+	e := newEncoder()
+	e.string(h.HalfHash)
+	e.bigInt(h.Nonce)
+	return e.Bytes()
 }
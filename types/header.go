@@ -0,0 +1,75 @@
+package types
+
+import (
+	"math/big"
+	"time"
+)
+
+// BlockHeader holds everything needed to check a block's proof of work and
+// its place in the chain without downloading its transactions.
+// Txs are committed through MerkleRoot.
+type BlockHeader struct {
+	Version    string    `json:"version,omitempty"`
+	PrevHash   string    `json:"prevhash,omitempty"`
+	MerkleRoot string    `json:"merkleroot,omitempty"`
+	Time       time.Time `json:"time,omitempty"`
+	Bits       uint32    `json:"bits,omitempty"`       // Target in compact form.
+	DiffLength *Work     `json:"difflength,omitempty"` // Work of the chain up to and including this block.
+	Nonce      *big.Int  `json:"nonce,omitempty"`
+}
+
+// Hash returns the canonical encoding of h, see MarshalBinary.
+func (h *BlockHeader) Hash() string {
+	return string(h.canonical())
+}
+
+// WithoutNonce returns a copy of h with Nonce unset, which is what miners
+// hash once before trying nonces (see HalfWay).
+func (h BlockHeader) WithoutNonce() *BlockHeader {
+	h.Nonce = nil
+	return &h
+}
+
+// Target decodes Bits.
+func (h *BlockHeader) Target() (*Target, error) {
+	return TargetFromCompact(h.Bits)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (h *BlockHeader) MarshalBinary() ([]byte, error) {
+	return h.canonical(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (h *BlockHeader) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data)
+	h.decode(d)
+	return d.finish()
+}
+
+func (h *BlockHeader) canonical() []byte {
+	e := newEncoder()
+	h.encode(e)
+	return e.Bytes()
+}
+
+// Field order: Version, PrevHash, MerkleRoot, Time, Bits, DiffLength, Nonce.
+func (h *BlockHeader) encode(e *encoder) {
+	e.string(h.Version)
+	e.string(h.PrevHash)
+	e.string(h.MerkleRoot)
+	e.time(h.Time)
+	e.uvarint(uint64(h.Bits))
+	e.bigInt((*big.Int)(h.DiffLength))
+	e.bigInt(h.Nonce)
+}
+
+func (h *BlockHeader) decode(d *decoder) {
+	h.Version = d.string()
+	h.PrevHash = d.string()
+	h.MerkleRoot = d.string()
+	h.Time = d.time()
+	h.Bits = uint32(d.uvarint())
+	h.DiffLength = (*Work)(d.bigInt())
+	h.Nonce = d.bigInt()
+}
@@ -0,0 +1,78 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/toqueteos/altcoin/coin"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Directions of a HistoryEntry.
+const (
+	HistoryIn  = "in"
+	HistoryOut = "out"
+)
+
+// HistoryEntry is one payment to or from Address.
+type HistoryEntry struct {
+	Address   string      `json:"address"`
+	TxHash    string      `json:"txhash"`
+	Height    int         `json:"height"`
+	Index     int         `json:"index"`
+	Direction string      `json:"direction"`
+	Amount    coin.Amount `json:"amount"`
+}
+
+func (e *HistoryEntry) JSON() string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(e)
+
+	return buf.String()
+}
+
+// Addresses are hex digits, the slash keeps one address from being the
+// prefix of another.
+func historyPrefix(addr string) string { return prefixHistory + addr + "/" }
+
+// Entries sort by height then position, a self payment has both directions.
+func historyKey(e *HistoryEntry) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(e.Height))
+	binary.BigEndian.PutUint64(b[8:], uint64(e.Index))
+	return historyPrefix(e.Address) + string(b[:]) + e.Direction
+}
+
+func (db *DB) PutHistory(e *HistoryEntry) error {
+	return db.Put(historyKey(e), e)
+}
+
+func (db *DB) DeleteHistory(e *HistoryEntry) error {
+	return db.Delete(historyKey(e))
+}
+
+// GetHistory returns up to limit entries of addr's history, newest first,
+// skipping the first offset ones. Only committed blocks are seen and it's
+// always empty unless AddressIndex is set.
+func (db *DB) GetHistory(addr string, offset, limit int) ([]*HistoryEntry, error) {
+	iter := db.Storage.NewIterator(util.BytesPrefix([]byte(historyPrefix(addr))), nil)
+	defer iter.Release()
+
+	var entries []*HistoryEntry
+	for ok := iter.Last(); ok && len(entries) < limit; ok = iter.Prev() {
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		var e HistoryEntry
+		if err := json.Unmarshal(iter.Value(), &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+	}
+	return entries, iter.Error()
+}
@@ -0,0 +1,68 @@
+package types
+
+// BlockIndex keeps the blocks of competing branches keyed by hash, so we can
+// switch to a branch once it gets more cumulative difficulty than ours. Main
+// chain blocks are on disk instead.
+type BlockIndex struct {
+	blocks map[string]*Block
+}
+
+func NewBlockIndex() *BlockIndex {
+	return &BlockIndex{blocks: make(map[string]*Block)}
+}
+
+func (idx *BlockIndex) Add(hash string, b *Block) { idx.blocks[hash] = b }
+func (idx *BlockIndex) Get(hash string) *Block    { return idx.blocks[hash] }
+func (idx *BlockIndex) Remove(hash string)        { delete(idx.blocks, hash) }
+func (idx *BlockIndex) Len() int                  { return len(idx.blocks) }
+
+// LeastWorkLeaf returns the block with the least DiffLength of those no other
+// block in the index builds on, and its hash. Only those can go without
+// leaving their children without a parent. nil if the index is empty.
+func (idx *BlockIndex) LeastWorkLeaf() (string, *Block) {
+	children := idx.children()
+
+	var hash string
+	var least *Block
+	for h, b := range idx.blocks {
+		if len(children[h]) > 0 {
+			continue
+		}
+		if least == nil || b.DiffLength.Cmp(least.DiffLength) < 0 {
+			hash, least = h, b
+		}
+	}
+	return hash, least
+}
+
+// RemoveTree forgets the block with hash and every block built on it.
+func (idx *BlockIndex) RemoveTree(hash string) {
+	idx.removeTree(hash, idx.children())
+}
+
+// Prune forgets every block below length and the ones built on them, they are
+// too deep to reorg to.
+func (idx *BlockIndex) Prune(length int) {
+	children := idx.children()
+	for hash, b := range idx.blocks {
+		if b.Length < length {
+			idx.removeTree(hash, children)
+		}
+	}
+}
+
+func (idx *BlockIndex) removeTree(hash string, children map[string][]string) {
+	delete(idx.blocks, hash)
+	for _, child := range children[hash] {
+		idx.removeTree(child, children)
+	}
+}
+
+// children maps every hash to the blocks built on it.
+func (idx *BlockIndex) children() map[string][]string {
+	children := make(map[string][]string, len(idx.blocks))
+	for hash, b := range idx.blocks {
+		children[b.PrevHash] = append(children[b.PrevHash], hash)
+	}
+	return children
+}
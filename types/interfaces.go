@@ -1,5 +1,8 @@
 package types
 
+// Hasher is implemented by everything that takes part in consensus hashes.
+// Hash returns the canonical binary encoding (as a string) that gets fed into
+// the hash function, never JSON.
 type Hasher interface {
 	Hash() string
 }
@@ -7,3 +10,18 @@ type Hasher interface {
 type Serializer interface {
 	JSON() string
 }
+
+// TxPool holds the txs waiting to be mined, see package mempool.
+// It's an interface so types doesn't need to import mempool.
+type TxPool interface {
+	Add(tx *Tx) error
+	Remove(hash string)
+	Get(hash string) *Tx
+	Pending(addr string, count int) *Tx
+	Replace(tx *Tx) ([]*Tx, error)
+	Count(addr string) int
+	Len() int
+	Txs() []*Tx
+	Select(maxSize int) []*Tx
+	Reset() []*Tx
+}
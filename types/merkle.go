@@ -0,0 +1,98 @@
+package types
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/toqueteos/altcoin/config"
+)
+
+// EmptyMerkleRoot is the root of a block without transactions.
+var EmptyMerkleRoot = strings.Repeat("0", 64)
+
+var ErrMerkleIndex = errors.New("types: tx index out of range")
+
+// MerkleStep is one level of an inclusion proof: the sibling hash and
+// whether it goes on the left of the running hash.
+type MerkleStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left,omitempty"`
+}
+
+// TxHash is the leaf value for tx in the Merkle tree, same as tools.DetHash(tx).
+func TxHash(tx *Tx) string {
+	return config.Hash(tx.Hash())
+}
+
+// merkleParent hashes two sibling nodes together.
+func merkleParent(left, right string) string {
+	return config.Hash(left + right)
+}
+
+// merkleLevels builds every level of the tree, leaves first.
+// A node without a sibling is promoted unchanged instead of being paired with
+// itself, so two different tx lists can never share a root.
+func merkleLevels(txs []*Tx) [][]string {
+	var level []string
+	for _, tx := range txs {
+		level = append(level, TxHash(tx))
+	}
+
+	levels := [][]string{level}
+	for len(level) > 1 {
+		var next []string
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleParent(level[i], level[i+1]))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+
+	return levels
+}
+
+// MerkleRoot returns the root of the Merkle tree built over the hashes of txs.
+func MerkleRoot(txs []*Tx) string {
+	if len(txs) == 0 {
+		return EmptyMerkleRoot
+	}
+	levels := merkleLevels(txs)
+	return levels[len(levels)-1][0]
+}
+
+// MerkleProof returns the sibling hashes needed to go from txs[index] up to
+// MerkleRoot(txs), see VerifyMerkleProof.
+func MerkleProof(txs []*Tx, index int) ([]MerkleStep, error) {
+	if index < 0 || index >= len(txs) {
+		return nil, ErrMerkleIndex
+	}
+
+	var proof []MerkleStep
+	levels := merkleLevels(txs)
+	for _, level := range levels[:len(levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, MerkleStep{Hash: level[sibling], Left: sibling < index})
+		}
+		index /= 2
+	}
+
+	return proof, nil
+}
+
+// VerifyMerkleProof reports whether proof links txHash to root.
+func VerifyMerkleProof(txHash, root string, proof []MerkleStep) bool {
+	h := txHash
+	for _, step := range proof {
+		if step.Left {
+			h = merkleParent(step.Hash, h)
+		} else {
+			h = merkleParent(h, step.Hash)
+		}
+	}
+	return h == root
+}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMerkle(t *testing.T) {
+	var txs []*Tx
+	for i := 0; i < 7; i++ {
+		txs = append(txs, &Tx{Type: "spend", Count: i})
+	}
+
+	Convey("Empty and single tx roots", t, func() {
+		So(MerkleRoot(nil), ShouldEqual, EmptyMerkleRoot)
+		So(MerkleRoot(txs[:1]), ShouldEqual, TxHash(txs[0]))
+	})
+
+	Convey("Every tx has a valid proof", t, func() {
+		for n := 1; n <= len(txs); n++ {
+			root := MerkleRoot(txs[:n])
+			for i := 0; i < n; i++ {
+				proof, err := MerkleProof(txs[:n], i)
+				So(err, ShouldBeNil)
+				So(VerifyMerkleProof(TxHash(txs[i]), root, proof), ShouldBeTrue)
+			}
+		}
+	})
+
+	Convey("Proofs don't verify other txs", t, func() {
+		root := MerkleRoot(txs)
+		proof, _ := MerkleProof(txs, 2)
+		So(VerifyMerkleProof(TxHash(txs[3]), root, proof), ShouldBeFalse)
+	})
+
+	Convey("Duplicating the last tx changes the root", t, func() {
+		So(MerkleRoot(append(txs[:3:3], txs[2])), ShouldNotEqual, MerkleRoot(txs[:3]))
+	})
+
+	Convey("Out of range index", t, func() {
+		_, err := MerkleProof(txs, len(txs))
+		So(err, ShouldEqual, ErrMerkleIndex)
+	})
+}
@@ -0,0 +1,204 @@
+package types
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/toqueteos/altcoin/config"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// SchemaVersion is the layout of keys in the database, stored under
+// metaKey("schema"). Bump it and teach Migrate about the old one whenever the
+// layout changes.
+const SchemaVersion = 1
+
+// Every kind of record lives under its own prefix so they can't collide and
+// each one can be iterated on its own.
+const (
+	prefixBlock   = "b:" // b:<height> -> Block
+	prefixHash    = "h:" // h:<hash> -> height
+	prefixAccount = "a:" // a:<address> -> Account
+	prefixUndo    = "u:" // u:<height> -> Undo
+	prefixMeta    = "m:" // m:<name> -> anything, tip and schema version
+	prefixTx      = "t:" // t:<hash> -> tx index
+	prefixHistory = "x:" // x:<address>/<height><index><direction> -> HistoryEntry
+)
+
+var (
+	ErrSchemaVersion  = errors.New("types: database schema is newer than this version of altcoin")
+	ErrSchemaLegacy   = errors.New("types: can't migrate legacy database")
+	ErrSchemaJSON     = errors.New("types: database has JSON blocks or integer amounts, it's from an old chain and must be deleted")
+	ErrSchemaEncoding = errors.New("types: database has blocks of another EncodingVersion, it's from an old chain and must be deleted")
+)
+
+// Heights are big endian so blocks iterate in chain order.
+func heightKey(prefix string, length int) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(length))
+	return prefix + string(b[:])
+}
+
+func blockKey(length int) string    { return heightKey(prefixBlock, length) }
+func undoKey(length int) string     { return heightKey(prefixUndo, length) }
+func hashKey(hash string) string    { return prefixHash + hash }
+func accountKey(addr string) string { return prefixAccount + addr }
+func metaKey(name string) string    { return prefixMeta + name }
+func txKey(hash string) string      { return prefixTx + hash }
+
+// schemaVersion returns the stored schema version, 0 if there is none.
+func (db *DB) schemaVersion() (int, error) {
+	value, err := db.get(metaKey("schema"))
+	switch err {
+	case leveldb.ErrNotFound:
+		return 0, nil
+	case nil:
+		return strconv.Atoi(string(value))
+	default:
+		return 0, err
+	}
+}
+
+// checkEncoding refuses databases whose blocks were written with another
+// EncodingVersion, they can't be decoded and their hashes changed anyway.
+func (db *DB) checkEncoding() error {
+	value, err := db.get(blockKey(0))
+	switch {
+	case err == leveldb.ErrNotFound:
+		return nil
+	case err != nil:
+		return err
+	case len(value) == 0 || value[0] != EncodingVersion:
+		return ErrSchemaEncoding
+	}
+	return nil
+}
+
+// Migrate brings the database up to SchemaVersion. Databases without a
+// schema version are either new or from before keys had prefixes, see
+// migrateLegacy.
+func (db *DB) Migrate() error {
+	version, err := db.schemaVersion()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case version > SchemaVersion:
+		return ErrSchemaVersion
+	case version == SchemaVersion:
+		return nil
+	}
+
+	db.Begin()
+	if err := db.migrateLegacy(); err != nil {
+		db.Discard()
+		return err
+	}
+	db.put(metaKey("schema"), []byte(strconv.Itoa(SchemaVersion)))
+	return db.Commit()
+}
+
+// migrateLegacy moves unprefixed records to their namespace. Blocks were
+// stored under their height, undo records under "undo:<height>", the tip
+// under "tip" and everything else is an account.
+//
+// Only the binary blocks and decimal amounts that came right before prefixes
+// are understood. Older databases, with JSON blocks and integer amounts, hold
+// a chain without our genesis block that couldn't be used anyway, they're
+// refused with ErrSchemaJSON and nothing is changed.
+func (db *DB) migrateLegacy() error {
+	iter := db.Storage.NewIterator(nil, nil)
+	defer iter.Release()
+
+	moved := 0
+	for iter.Next() {
+		k := string(iter.Key())
+		value := append([]byte(nil), iter.Value()...)
+
+		var newKey string
+		switch {
+		case len(k) > 1 && k[1] == ':':
+			// Already prefixed, legacy keys never look like this.
+			continue
+		case k == "tip":
+			newKey = metaKey("tip")
+		case len(k) > len("undo:") && k[:len("undo:")] == "undo:":
+			n, err := strconv.Atoi(k[len("undo:"):])
+			if err != nil {
+				return fmt.Errorf("%v: bad undo key %q", ErrSchemaLegacy, k)
+			}
+			newKey = undoKey(n)
+		case isLegacyHeight(k):
+			n, _ := strconv.Atoi(k)
+			if len(value) > 0 && value[0] == '{' {
+				return ErrSchemaJSON
+			}
+			var b Block
+			if err := b.UnmarshalBinary(value); err != nil {
+				return fmt.Errorf("%v: block %d: %v", ErrSchemaLegacy, n, err)
+			}
+			db.put(hashKey(config.Hash(b.Hash())), []byte(k))
+			if err := db.indexTxs(&b); err != nil {
+				return err
+			}
+			newKey = blockKey(n)
+		default:
+			if _, err := decodeAccount(value); err != nil {
+				return ErrSchemaJSON
+			}
+			newKey = accountKey(k)
+		}
+
+		db.delete(k)
+		db.put(newKey, value)
+		moved++
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	if moved > 0 {
+		log.Printf("Migrate: moved %d legacy records to schema version %d", moved, SchemaVersion)
+	}
+	return nil
+}
+
+// isLegacyHeight tells block heights apart from addresses, which are much
+// longer than any height.
+func isLegacyHeight(k string) bool {
+	if k == "" || len(k) > 19 {
+		return false
+	}
+	for _, c := range k {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ForEachAccount calls fn with every stored account until fn returns an
+// error, which is then returned. Writes of a batch that wasn't committed yet
+// aren't seen.
+func (db *DB) ForEachAccount(fn func(addr string, acc *Account) error) error {
+	iter := db.Storage.NewIterator(util.BytesPrefix([]byte(prefixAccount)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		addr := string(iter.Key()[len(prefixAccount):])
+		acc, err := decodeAccount(iter.Value())
+		if err != nil {
+			return err
+		}
+		if err := fn(addr, acc); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
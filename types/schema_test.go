@@ -0,0 +1,127 @@
+package types
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/toqueteos/altcoin/config"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+func TestMigrate(t *testing.T) {
+	Convey("Legacy records move to their namespace", t, func() {
+		ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+		So(err, ShouldBeNil)
+
+		block := &Block{
+			BlockHeader: BlockHeader{Time: time.Unix(1, 0), Bits: 0x1d00ffff, DiffLength: NewWork(1), Nonce: big.NewInt(3)},
+			Txs:         []*Tx{testTx()},
+		}
+		value, err := block.MarshalBinary()
+		So(err, ShouldBeNil)
+		hash := config.Hash(block.Hash())
+		addr := "11" + strings.Repeat("3a", 29)
+
+		So(ldb.Put([]byte("0"), value, nil), ShouldBeNil)
+		So(ldb.Put([]byte(addr), []byte(`{"amount":"1.00000","count":2}`), nil), ShouldBeNil)
+		So(ldb.Put([]byte("tip"), []byte(`{"length":0,"hash":"`+hash+`","difflength":"1"}`), nil), ShouldBeNil)
+
+		db, err := OpenChain(ldb)
+		So(err, ShouldBeNil)
+		So(db.Length, ShouldEqual, 0)
+		So(db.GetBlockByHash(hash), ShouldNotBeNil)
+		tx, _ := db.GetTx(TxHash(block.Txs[0]))
+		So(tx, ShouldNotBeNil)
+		acc, err := db.GetAccount(addr)
+		So(err, ShouldBeNil)
+		So(*acc, ShouldResemble, Account{Amount: 100000, Count: 2})
+
+		_, err = ldb.Get([]byte("0"), nil)
+		So(err, ShouldEqual, leveldb.ErrNotFound)
+
+		version, err := db.schemaVersion()
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, SchemaVersion)
+	})
+
+	Convey("Identical txs stay indexed whatever order blocks migrate in", t, func() {
+		ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+		So(err, ShouldBeNil)
+
+		// "10" comes before "2" in key order.
+		var blocks []*Block
+		for _, length := range []int{2, 10} {
+			block := &Block{
+				BlockHeader: BlockHeader{Time: time.Unix(1, 0), Bits: 0x1d00ffff, DiffLength: NewWork(1), Nonce: big.NewInt(3)},
+				Length:      length,
+				Txs:         []*Tx{testTx()},
+			}
+			value, err := block.MarshalBinary()
+			So(err, ShouldBeNil)
+			So(ldb.Put([]byte(strconv.Itoa(length)), value, nil), ShouldBeNil)
+			blocks = append(blocks, block)
+		}
+
+		db := NewDB(ldb)
+		So(db.Migrate(), ShouldBeNil)
+		hash := TxHash(testTx())
+		_, loc := db.GetTx(hash)
+		So(*loc, ShouldResemble, TxLocation{Height: 2, Index: 0})
+
+		So(db.unindexTxs(blocks[1]), ShouldBeNil)
+		_, loc = db.GetTx(hash)
+		So(*loc, ShouldResemble, TxLocation{Height: 2, Index: 0})
+		So(db.unindexTxs(blocks[0]), ShouldBeNil)
+		_, loc = db.GetTx(hash)
+		So(loc, ShouldBeNil)
+	})
+
+	Convey("Databases with JSON blocks are refused untouched", t, func() {
+		ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+		So(err, ShouldBeNil)
+		addr := "11" + strings.Repeat("3a", 29)
+		So(ldb.Put([]byte("0"), []byte(`{"length":0,"target":"ff","txs":[{"amount":5,"to":"`+addr+`","type":"mint"}]}`), nil), ShouldBeNil)
+		So(ldb.Put([]byte(addr), []byte(`{"amount":5,"count":1}`), nil), ShouldBeNil)
+
+		_, err = OpenChain(ldb)
+		So(err, ShouldEqual, ErrSchemaJSON)
+		_, err = ldb.Get([]byte("0"), nil)
+		So(err, ShouldBeNil)
+
+		// Accounts alone give it away too.
+		So(ldb.Delete([]byte("0"), nil), ShouldBeNil)
+		_, err = OpenChain(ldb)
+		So(err, ShouldEqual, ErrSchemaJSON)
+		_, err = ldb.Get([]byte(addr), nil)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Databases with blocks of an older encoding are refused", t, func() {
+		ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+		So(err, ShouldBeNil)
+		block := &Block{BlockHeader: BlockHeader{Time: time.Unix(1, 0), Bits: 0x1d00ffff, DiffLength: NewWork(1)}}
+		value, err := block.MarshalBinary()
+		So(err, ShouldBeNil)
+		value[0] = EncodingVersion - 1
+		So(ldb.Put([]byte(blockKey(0)), value, nil), ShouldBeNil)
+		So(ldb.Put([]byte(metaKey("schema")), []byte(strconv.Itoa(SchemaVersion)), nil), ShouldBeNil)
+
+		_, err = OpenChain(ldb)
+		So(err, ShouldEqual, ErrSchemaEncoding)
+	})
+
+	Convey("Newer schemas are refused", t, func() {
+		ldb, err := leveldb.Open(storage.NewMemStorage(), nil)
+		So(err, ShouldBeNil)
+		So(ldb.Put([]byte(metaKey("schema")), []byte("99"), nil), ShouldBeNil)
+
+		_, err = OpenChain(ldb)
+		So(err, ShouldEqual, ErrSchemaVersion)
+	})
+}
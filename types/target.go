@@ -0,0 +1,142 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	ErrBadCompact = errors.New("types: compact target is negative or too big")
+	ErrBadWork    = errors.New("types: work isn't a hex number")
+)
+
+// Target is the highest proof of work hash a block may have, the lower it is
+// the harder the block is to mine. Blocks carry it in compact form, see
+// Compact. Targets are never modified once made.
+type Target big.Int
+
+var oneLsh256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// NewTarget returns a target equal to n.
+func NewTarget(n *big.Int) *Target {
+	return (*Target)(new(big.Int).Set(n))
+}
+
+// TargetFromCompact decodes Bitcoin's compact form (nBits): the high byte is
+// the length of the number in bytes and the low three ones are its first
+// bytes, 0x00800000 being a sign bit. Negative targets and targets above 2^256
+// are refused.
+func TargetFromCompact(bits uint32) (*Target, error) {
+	size := uint(bits >> 24)
+	mantissa := bits & 0x007fffff
+	if mantissa != 0 && bits&0x00800000 != 0 {
+		return nil, ErrBadCompact
+	}
+
+	n := big.NewInt(int64(mantissa))
+	if size <= 3 {
+		n.Rsh(n, 8*(3-size))
+	} else {
+		n.Lsh(n, 8*(size-3))
+	}
+	if n.Cmp(oneLsh256) >= 0 {
+		return nil, ErrBadCompact
+	}
+	return (*Target)(n), nil
+}
+
+func (t *Target) int() *big.Int { return (*big.Int)(t) }
+
+// Int returns t as a big.Int the caller can modify.
+func (t *Target) Int() *big.Int { return new(big.Int).Set(t.int()) }
+
+// Compact returns t in compact form, which only keeps its first three
+// significant bytes, the rest are taken as zeros.
+func (t *Target) Compact() uint32 {
+	n := t.int()
+	size := uint((n.BitLen() + 7) / 8)
+
+	var mantissa uint32
+	if size <= 3 {
+		mantissa = uint32(n.Uint64() << (8 * (3 - size)))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(n, 8*(size-3)).Uint64())
+	}
+	// The top bit is the sign, move everything one byte down.
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+	return uint32(size)<<24 | mantissa
+}
+
+// Cmp compares t and u the way big.Int.Cmp does.
+func (t *Target) Cmp(u *Target) int { return t.int().Cmp(u.int()) }
+
+// CheckHash reports whether the hex hash meets t.
+func (t *Target) CheckHash(hash string) bool {
+	n, ok := new(big.Int).SetString(hash, 16)
+	return ok && n.Sign() >= 0 && n.Cmp(t.int()) <= 0
+}
+
+// Work is how many hashes it takes on average to find one meeting t:
+// 2^256 / (t+1).
+func (t *Target) Work() *Work {
+	n := new(big.Int).Add(t.int(), big.NewInt(1))
+	return (*Work)(n.Div(oneLsh256, n))
+}
+
+// String returns t as 64 hex digits.
+func (t *Target) String() string { return fmt.Sprintf("%064x", t.int()) }
+
+// Work is an amount of hashing, the work of a chain is what all of its blocks'
+// targets took to meet. The chain with the most work is the main one.
+// Like Target, Work values are never modified once made.
+type Work big.Int
+
+// NewWork returns n hashes worth of work.
+func NewWork(n int64) *Work { return (*Work)(big.NewInt(n)) }
+
+// ParseWork reads work written in hex.
+func ParseWork(s string) (*Work, error) {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok || n.Sign() < 0 {
+		return nil, ErrBadWork
+	}
+	return (*Work)(n), nil
+}
+
+func (w *Work) int() *big.Int { return (*big.Int)(w) }
+
+// Add returns w + v.
+func (w *Work) Add(v *Work) *Work {
+	return (*Work)(new(big.Int).Add(w.int(), v.int()))
+}
+
+// Cmp compares w and v the way big.Int.Cmp does, nil is no work at all.
+func (w *Work) Cmp(v *Work) int {
+	if w == nil {
+		w = NewWork(0)
+	}
+	if v == nil {
+		v = NewWork(0)
+	}
+	return w.int().Cmp(v.int())
+}
+
+// String returns w in hex without leading zeros.
+func (w *Work) String() string { return w.int().Text(16) }
+
+// MarshalText implements encoding.TextMarshaler, work travels in hex.
+func (w *Work) MarshalText() ([]byte, error) { return []byte(w.String()), nil }
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (w *Work) UnmarshalText(text []byte) error {
+	v, err := ParseWork(string(text))
+	if err != nil {
+		return err
+	}
+	w.int().Set(v.int())
+	return nil
+}
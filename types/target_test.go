@@ -0,0 +1,69 @@
+package types
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTargetCompact(t *testing.T) {
+	Convey("Compact form matches Bitcoin's", t, func() {
+		vectors := []struct {
+			bits   uint32
+			target string
+		}{
+			{0x1d00ffff, "00000000ffff0000000000000000000000000000000000000000000000000000"},
+			{0x1b0404cb, "00000000000404cb000000000000000000000000000000000000000000000000"},
+			{0x03123456, "0000000000000000000000000000000000000000000000000000000000123456"},
+			{0x02008000, "0000000000000000000000000000000000000000000000000000000000000080"},
+			{0x01003456, "0000000000000000000000000000000000000000000000000000000000000000"},
+		}
+		for _, v := range vectors {
+			target, err := TargetFromCompact(v.bits)
+			So(err, ShouldBeNil)
+			So(target.String(), ShouldEqual, v.target)
+		}
+
+		So(NewTarget(big.NewInt(0x80)).Compact(), ShouldEqual, 0x02008000)
+		So(NewTarget(new(big.Int).Lsh(big.NewInt(0xffff), 208)).Compact(), ShouldEqual, 0x1d00ffff)
+	})
+
+	Convey("Negative and overflowing targets are refused", t, func() {
+		_, err := TargetFromCompact(0x04923456)
+		So(err, ShouldEqual, ErrBadCompact)
+		_, err = TargetFromCompact(0x2200ffff)
+		So(err, ShouldEqual, ErrBadCompact)
+	})
+
+	Convey("Hashes are compared as numbers", t, func() {
+		target := NewTarget(big.NewInt(0x0f))
+		So(target.CheckHash("000f"), ShouldBeTrue)
+		So(target.CheckHash("0010"), ShouldBeFalse)
+		So(target.CheckHash("zz"), ShouldBeFalse)
+	})
+}
+
+func TestWork(t *testing.T) {
+	Convey("Harder targets are more work", t, func() {
+		easy, _ := TargetFromCompact(0x1d00ffff)
+		hard, _ := TargetFromCompact(0x1c00ffff)
+		So(hard.Work().Cmp(easy.Work()), ShouldBeGreaterThan, 0)
+		So(easy.Work().String(), ShouldEqual, "100010001")
+	})
+
+	Convey("Work adds up and travels in hex", t, func() {
+		sum := NewWork(255).Add(NewWork(1))
+		So(sum.Cmp(NewWork(256)), ShouldEqual, 0)
+
+		data, err := json.Marshal(sum)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `"100"`)
+
+		var out Work
+		So(json.Unmarshal(data, &out), ShouldBeNil)
+		So((*big.Int)(&out).Int64(), ShouldEqual, 256)
+		So(json.Unmarshal([]byte(`"-1"`), &out), ShouldNotBeNil)
+	})
+}
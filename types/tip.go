@@ -0,0 +1,23 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Tip is the last block of the main chain as of the last committed write.
+// It's stored in the same batch as the block itself so it always matches what
+// is on disk.
+type Tip struct {
+	Length     int    `json:"length"`
+	Hash       string `json:"hash"`
+	DiffLength *Work  `json:"difflength"`
+}
+
+func (t *Tip) JSON() string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(t)
+
+	return buf.String()
+}
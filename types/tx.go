@@ -1,29 +1,66 @@
 package types
 
 import (
-	"bytes"
-	"encoding/json"
+	"github.com/toqueteos/altcoin/coin"
 
 	"github.com/conformal/btcec"
 )
 
 // Tx holds all related info for a transaction
-// NOTE: Types int/int64 are probably not enough for Amount.
-// Python has Long (big) numbers support builtin, Go doesn't, so "the big.Int way"
 // Extracted from `gui.py:13`
 type Tx struct {
-	Amount     int                `json:"amount,omitempty"`
+	Amount     coin.Amount        `json:"amount,omitempty"`
 	Count      int                `json:"count,omitempty"`
+	Fee        coin.Amount        `json:"fee,omitempty"`    // Paid to the miner on top of Amount.
+	Height     int                `json:"height,omitempty"` // Of the block a mint is in, so no two mints are alike.
 	PubKeys    []*btcec.PublicKey `json:"pubkeys,omitempty"`
 	Signatures []*btcec.Signature `json:"signatures,omitempty"`
 	To         string             `json:"to,omitempty"`
 	Type       string             `json:"type,omitempty"`
 }
 
+// Hash returns the canonical encoding of tx, see MarshalBinary.
 func (t *Tx) Hash() string {
-	var b bytes.Buffer
-	enc := json.NewEncoder(&b)
-	enc.Encode(t)
+	return string(t.canonical())
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (t *Tx) MarshalBinary() ([]byte, error) {
+	return t.canonical(), nil
+}
+
+func (t *Tx) canonical() []byte {
+	e := newEncoder()
+	t.encode(e)
+	return e.Bytes()
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (t *Tx) UnmarshalBinary(data []byte) error {
+	d := newDecoder(data)
+	t.decode(d)
+	return d.finish()
+}
+
+// Field order: Amount, Count, Fee, Height, PubKeys, Signatures, To, Type.
+func (t *Tx) encode(e *encoder) {
+	e.amount(t.Amount)
+	e.int(t.Count)
+	e.amount(t.Fee)
+	e.int(t.Height)
+	e.pubKeys(t.PubKeys)
+	e.signatures(t.Signatures)
+	e.string(t.To)
+	e.string(t.Type)
+}
 
-	return b.String()
+func (t *Tx) decode(d *decoder) {
+	t.Amount = d.amount()
+	t.Count = d.int()
+	t.Fee = d.amount()
+	t.Height = d.int()
+	t.PubKeys = d.pubKeys()
+	t.Signatures = d.signatures()
+	t.To = d.string()
+	t.Type = d.string()
 }
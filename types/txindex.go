@@ -0,0 +1,122 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"sort"
+)
+
+// TxLocation is where a mined tx is: the height of its block and its
+// position in the block's Txs.
+type TxLocation struct {
+	Height int `json:"height"`
+	Index  int `json:"index"`
+}
+
+func (l *TxLocation) JSON() string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(l)
+
+	return buf.String()
+}
+
+// txLocations are every place a tx hash is found in the main chain, oldest
+// first. Identical txs would share a hash (mints carry their Height so they
+// don't), keeping all of them means disconnecting one block doesn't lose the
+// others.
+type txLocations []TxLocation
+
+func (ls txLocations) JSON() string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(ls)
+
+	return buf.String()
+}
+
+func (db *DB) getTxLocations(hash string) txLocations {
+	value, err := db.get(txKey(hash))
+	if err != nil {
+		return nil
+	}
+
+	var ls txLocations
+	if err := json.Unmarshal(value, &ls); err != nil {
+		log.Println("json.Unmarshal error:", err)
+		return nil
+	}
+	return ls
+}
+
+func (db *DB) putTxLocations(hash string, ls txLocations) error {
+	if len(ls) == 0 {
+		return db.Delete(txKey(hash))
+	}
+	return db.Put(txKey(hash), ls)
+}
+
+// GetTx finds a main chain tx by its hash (TxHash), nil if there is none.
+// Identical txs are found at their oldest location.
+func (db *DB) GetTx(hash string) (*Tx, *TxLocation) {
+	ls := db.getTxLocations(hash)
+	if len(ls) == 0 {
+		return nil, nil
+	}
+
+	l := ls[0]
+	b := db.GetBlock(l.Height)
+	if b == nil || l.Index >= len(b.Txs) {
+		return nil, nil
+	}
+	return b.Txs[l.Index], &l
+}
+
+// indexTxs adds b's txs to the tx index, indexing a block twice does nothing.
+func (db *DB) indexTxs(b *Block) error {
+	for i, tx := range b.Txs {
+		hash := TxHash(tx)
+		l := TxLocation{Height: b.Length, Index: i}
+
+		ls := db.getTxLocations(hash)
+		at := sort.Search(len(ls), func(j int) bool { return !ls[j].before(&l) })
+		if at < len(ls) && ls[at] == l {
+			continue
+		}
+		ls = append(ls, TxLocation{})
+		copy(ls[at+1:], ls[at:])
+		ls[at] = l
+
+		if err := db.putTxLocations(hash, ls); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexTxs removes the entries indexTxs added for b, the ones of identical
+// txs in other blocks stay.
+func (db *DB) unindexTxs(b *Block) error {
+	for _, tx := range b.Txs {
+		hash := TxHash(tx)
+		ls := db.getTxLocations(hash)
+		kept := ls[:0]
+		for _, l := range ls {
+			if l.Height != b.Length {
+				kept = append(kept, l)
+			}
+		}
+		if len(kept) == len(ls) {
+			continue
+		}
+		if err := db.putTxLocations(hash, kept); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *TxLocation) before(m *TxLocation) bool {
+	return l.Height < m.Height || l.Height == m.Height && l.Index < m.Index
+}
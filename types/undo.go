@@ -0,0 +1,26 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Undo holds what connecting a block changed so it can be disconnected
+// without running its txs backwards.
+type Undo struct {
+	// Accounts maps every address the block wrote to its account right
+	// before the block, nil if the account didn't exist yet.
+	Accounts map[string]*Account `json:"accounts"`
+}
+
+func NewUndo() *Undo {
+	return &Undo{Accounts: make(map[string]*Account)}
+}
+
+func (u *Undo) JSON() string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(u)
+
+	return buf.String()
+}